@@ -33,6 +33,11 @@ func InitSQLiteGlobal() error {
 			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
 				conn.SetLimit(sqlite3.SQLITE_LIMIT_ATTACHED, SKYALT_MAX_DBS) //wont go above 10? Recompile sqlite? ...
 				//fmt.Println(conn.GetLimit(sqlite3.SQLITE_LIMIT_ATTACHED))
+
+				//table-level changes
+				conn.RegisterUpdateHook(func(op int, dbName string, table string, rowid int64) {
+					DiskDb_updateHook(conn.GetFilename(dbName), table)
+				})
 				return nil
 			},
 		})
@@ -44,6 +49,8 @@ type Disk struct {
 
 	dbs map[string]*DiskDb
 
+	watches map[string]*DiskWatch
+
 	net *DiskNet
 }
 
@@ -51,6 +58,7 @@ func NewDisk() (*Disk, error) {
 	var disk Disk
 
 	disk.dbs = make(map[string]*DiskDb)
+	disk.watches = make(map[string]*DiskWatch)
 
 	disk.net = NewDiskNet()
 
@@ -61,6 +69,9 @@ func (disk *Disk) Destroy() {
 	for _, db := range disk.dbs {
 		db.Destroy()
 	}
+	for _, w := range disk.watches {
+		w.Destroy()
+	}
 
 	disk.net.Destroy()
 }
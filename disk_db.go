@@ -17,10 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type DiskDbIndexColumn struct {
@@ -83,20 +86,49 @@ func (tb *DiskDbIndexTable) ListOfColumnValues(withRowId bool) string {
 }
 
 type DiskDbTime struct {
-	file     int64
-	file_wal int64
-	file_shm int64
+	version int64 //0 = never seen
 }
 
-func InitDiskDbTime(filePath string) DiskDbTime {
-	var tm DiskDbTime
-	tm.file = OsFileTime(filePath)
-	tm.file_wal = OsFileTime(filePath + "-wal")
-	tm.file_shm = OsFileTime(filePath + "-shm")
-	return tm
-}
 func (a *DiskDbTime) Cmp(b *DiskDbTime) bool {
-	return a.file == b.file && a.file_wal == b.file_wal && a.file_shm == b.file_shm
+	return a.version == b.version
+}
+
+var g_DiskDb_hooks sync.Map    //hook key -> *DiskDb
+var g_DiskDb_hookKeys sync.Map //file name from sqlite -> hook key, so update hook doesn't resolve path for every row
+
+var g_DiskDb_lastVersion atomic.Int64 //shared by all dbs, so version never goes back after db is reopened
+
+func DiskDb_nextVersion() int64 {
+	return g_DiskDb_lastVersion.Add(1)
+}
+
+// absolute path without symlinks, same for path from app and file name from sqlite
+func DiskDb_hookKey(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("Abs() failed: %w", err)
+	}
+	realPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		return "", fmt.Errorf("EvalSymlinks() failed: %w", err)
+	}
+	return realPath, nil
+}
+
+func DiskDb_updateHook(path string, table string) {
+	key, found := g_DiskDb_hookKeys.Load(path)
+	if !found {
+		k, err := DiskDb_hookKey(path)
+		if err != nil {
+			return
+		}
+		key, _ = g_DiskDb_hookKeys.LoadOrStore(path, k)
+	}
+
+	db, found := g_DiskDb_hooks.Load(key)
+	if found {
+		db.(*DiskDb).onUpdate(table)
+	}
 }
 
 type DiskDb struct {
@@ -107,14 +139,21 @@ type DiskDb struct {
 	path     string
 	inMemory bool
 	db       *sql.DB
+	hook_key string //"" = not registered
 	//tx *sql.Tx
 
 	lastWriteTicks int64
 	lastReadTicks  int64
 
-	time DiskDbTime
+	//changes
+	changes_lock   sync.Mutex
+	version        int64            //increases with every detected change
+	tables_version map[string]int64 //table -> version of last change
+	all_version    int64            //version of last change with unknown tables(external writer)
 
-	last_file_tick int64
+	version_conn    *sql.Conn //'PRAGMA data_version' is per connection
+	data_version    int64
+	last_check_tick int64
 }
 
 func NewDiskDb(path string, inMemory bool, disk *Disk) (*DiskDb, error) {
@@ -125,19 +164,45 @@ func NewDiskDb(path string, inMemory bool, disk *Disk) (*DiskDb, error) {
 
 	if inMemory {
 		var err error
-		db.db, err = sql.Open("sqlite3", "file:"+path+"?mode=memory&cache=shared") //sqlite3 -> sqlite3_skyalt
+		db.db, err = sql.Open("sqlite3_skyalt", "file:"+path+"?mode=memory&cache=shared")
 		if err != nil {
 			return nil, fmt.Errorf("sql.Open(%s) in memory failed: %w", path, err)
 		}
 	} else {
 		var err error
-		db.db, err = sql.Open("sqlite3", "file:"+path+"?&_journal_mode=WAL") //sqlite3 -> sqlite3_skyalt
+		db.db, err = sql.Open("sqlite3_skyalt", "file:"+path+"?&_journal_mode=WAL")
 		if err != nil {
 			return nil, fmt.Errorf("sql.Open(%s) from file failed: %w", path, err)
 		}
 	}
 
-	db.updateTime(false)
+	db.version = DiskDb_nextVersion()
+	db.all_version = db.version //file could be changed while it was closed
+	db.tables_version = make(map[string]int64)
+
+	var err error
+	db.version_conn, err = db.db.Conn(context.Background())
+	if err != nil {
+		db.db.Close()
+		return nil, fmt.Errorf("Conn(%s) failed: %w", path, err)
+	}
+	err = db.version_conn.QueryRowContext(context.Background(), "PRAGMA data_version").Scan(&db.data_version)
+	if err != nil {
+		db.version_conn.Close()
+		db.db.Close()
+		return nil, fmt.Errorf("data_version(%s) failed: %w", path, err)
+	}
+	db.last_check_tick = OsTicks()
+
+	if !inMemory {
+		key, err := DiskDb_hookKey(path) //file exists after first query
+		if err == nil {
+			db.hook_key = key
+			g_DiskDb_hooks.Store(key, &db)
+		} else {
+			fmt.Printf("db(%s): changes from update hook are not detected: %v\n", path, err)
+		}
+	}
 
 	return &db, nil
 }
@@ -150,26 +215,94 @@ func (db *DiskDb) Destroy() {
 
 	//db.Commit()
 
+	if db.hook_key != "" {
+		g_DiskDb_hooks.Delete(db.hook_key)
+	}
+
+	db.version_conn.Close()
 	err := db.db.Close()
 	if err != nil {
 		fmt.Printf("db(%s).Destroy() failed: %v\n", db.path, err)
 	}
 }
 
-func (db *DiskDb) updateTime(writeInto bool) {
-	db.time = InitDiskDbTime(db.path)
-	db.last_file_tick = OsTicks()
+// called from sqlite update hook(any connection inside this process)
+func (db *DiskDb) onUpdate(table string) {
+	db.changes_lock.Lock()
+	defer db.changes_lock.Unlock()
 
-	if writeInto {
-		db.lastWriteTicks = int64(OsTicks())
+	db.version = DiskDb_nextVersion()
+	db.tables_version[table] = db.version
+}
+
+func (db *DiskDb) readDataVersion() (int64, error) {
+	var data_version int64
+	err := db.version_conn.QueryRowContext(context.Background(), "PRAGMA data_version").Scan(&data_version)
+	if err != nil {
+		return 0, fmt.Errorf("data_version(%s) failed: %w", db.path, err)
 	}
+	return data_version, nil
+}
+
+// data_version changes when other connection commits. Writes from Write_unsafe() are absorbed right after commit, so any other change is from unknown writer
+func (db *DiskDb) checkVersion() {
+	data_version, err := db.readDataVersion()
+	if err != nil {
+		fmt.Printf("db(%s).checkVersion() failed: %v\n", db.path, err)
+		return
+	}
+
+	db.changes_lock.Lock()
+	defer db.changes_lock.Unlock()
+
+	if data_version != db.data_version {
+		db.version = DiskDb_nextVersion()
+		db.all_version = db.version //tables are unknown
+		db.data_version = data_version
+	}
+	db.last_check_tick = OsTicks()
+}
+
+// own commit changed data_version, tables are already known from update hook
+func (db *DiskDb) absorbOwnWrite() {
+	data_version, err := db.readDataVersion()
+	if err != nil {
+		fmt.Printf("db(%s).absorbOwnWrite() failed: %v\n", db.path, err)
+		return
+	}
+
+	db.changes_lock.Lock()
+	defer db.changes_lock.Unlock()
+
+	db.data_version = data_version
 }
 
 func (db *DiskDb) GetTime() DiskDbTime {
-	if db.last_file_tick == 0 || !OsIsTicksIn(db.last_file_tick, 2000) {
-		db.updateTime(false)
+	if !OsIsTicksIn(db.last_check_tick, 500) {
+		db.checkVersion()
 	}
-	return db.time
+
+	db.changes_lock.Lock()
+	defer db.changes_lock.Unlock()
+
+	return DiskDbTime{version: db.version}
+}
+
+// returns tables changed after 'since'. all=true means that tables are unknown(external writer or first check)
+func (db *DiskDb) GetChangedTables(since DiskDbTime) (tables []string, all bool) {
+	db.changes_lock.Lock()
+	defer db.changes_lock.Unlock()
+
+	if since.version == 0 || db.all_version > since.version {
+		return nil, true
+	}
+
+	for tb, ver := range db.tables_version {
+		if ver > since.version {
+			tables = append(tables, tb)
+		}
+	}
+	return tables, false
 }
 
 func (db *DiskDb) GetTableInfo() ([]*DiskDbIndexTable, error) {
@@ -242,7 +375,6 @@ func (db *DiskDb) Vacuum() error {
 	defer db.lock.Unlock()
 
 	_, err := db.db.Exec("VACUUM;")
-	db.updateTime(false)
 	return err
 }
 
@@ -253,12 +385,16 @@ func (db *DiskDb) Write_unsafe(query string, params ...any) (sql.Result, error)
 	//}
 	//res, err := tx.Exec(query, params...)
 
+	db.checkVersion() //external changes before this write
+
 	res, err := db.db.Exec(query, params...)
 	if err != nil {
 		return nil, fmt.Errorf("query(%s) failed: %w", query, err)
 	}
 
-	db.updateTime(true)
+	db.absorbOwnWrite()
+
+	db.lastWriteTicks = int64(OsTicks())
 	return res, nil
 }
 
@@ -269,6 +405,38 @@ func (db *DiskDb) Write(query string, params ...any) (sql.Result, error) {
 	return db.Write_unsafe(query, params...)
 }
 
+// all writes from fn are in one transaction
+func (db *DiskDb) WriteTx(fn func(tx *sql.Tx) error) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.checkVersion() //external changes before this write
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Begin(%s) failed: %w", db.path, err)
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("Commit(%s) failed: %w", db.path, err)
+	}
+
+	db.absorbOwnWrite()
+
+	db.lastWriteTicks = int64(OsTicks())
+	return nil
+}
+
+// table or column name inside SQL
+func DiskDb_quoteName(name string) string {
+	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
+}
+
 func (db *DiskDb) Lock() {
 	db.lock.Lock()
 }
@@ -286,6 +454,18 @@ func (db *DiskDb) Read_unsafe(query string, params ...any) (*sql.Rows, error) {
 	return db.db.Query(query, params...)
 }
 
+// separate connection opened with mode=ro, query can't write even with more statements or pragmas. Caller must Close() it
+func (db *DiskDb) OpenReadOnly() (*sql.DB, error) {
+	if db.inMemory {
+		return nil, fmt.Errorf("in-memory db can't be opened read-only")
+	}
+	ro, err := sql.Open("sqlite3_skyalt", "file:"+db.path+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open(%s) read-only failed: %w", db.path, err)
+	}
+	return ro, nil
+}
+
 func (db *DiskDb) Print() error {
 
 	tables, err := db.GetTableInfo() //lock/unlock inside!
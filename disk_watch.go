@@ -0,0 +1,245 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DiskWatch_CREATED  = 0
+	DiskWatch_MODIFIED = 1
+	DiskWatch_DELETED  = 2
+)
+
+type DiskWatchEvents struct {
+	Created  []string
+	Modified []string
+	Deleted  []string
+}
+
+// events which weren't read by one consumer yet
+type DiskWatchPending struct {
+	created  map[string]bool
+	modified map[string]bool
+	deleted  map[string]bool
+}
+
+func NewDiskWatchPending() *DiskWatchPending {
+	p := &DiskWatchPending{}
+	p.created = make(map[string]bool)
+	p.modified = make(map[string]bool)
+	p.deleted = make(map[string]bool)
+	return p
+}
+
+func (p *DiskWatchPending) isEmpty() bool {
+	return len(p.created) == 0 && len(p.modified) == 0 && len(p.deleted) == 0
+}
+
+func (p *DiskWatchPending) add(path string, tp int) {
+	switch tp {
+	case DiskWatch_CREATED:
+		if p.deleted[path] {
+			delete(p.deleted, path)
+			p.modified[path] = true //deleted + created = modified
+		} else {
+			p.created[path] = true
+		}
+
+	case DiskWatch_MODIFIED:
+		if !p.created[path] {
+			p.modified[path] = true
+		}
+
+	case DiskWatch_DELETED:
+		delete(p.modified, path)
+		if p.created[path] {
+			delete(p.created, path) //created + deleted = nothing
+		} else {
+			p.deleted[path] = true
+		}
+	}
+}
+
+type DiskWatch struct {
+	dir     string
+	pattern string //glob, "" = all files
+
+	lock sync.Mutex
+
+	readers map[string]*DiskWatchPending //every consumer(watch node) has own events
+
+	last_event_tick int64
+	start_tick      int64
+
+	err  error
+	stop atomic.Bool
+}
+
+// path can be folder("data/") or glob("data/*.wav")
+func NewDiskWatch(path string) *DiskWatch {
+	w := &DiskWatch{}
+
+	w.dir = path
+	if strings.ContainsAny(filepath.Base(path), "*?[") {
+		w.dir = filepath.Dir(path)
+		w.pattern = filepath.Base(path)
+	}
+
+	w.readers = make(map[string]*DiskWatchPending)
+
+	w.start_tick = OsTicks()
+
+	go w.run() //linux: inotify, others: polling
+
+	return w
+}
+
+func (w *DiskWatch) Destroy() {
+	w.stop.Store(true)
+}
+
+func (w *DiskWatch) setError(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.err = err
+}
+
+func (w *DiskWatch) GetError() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.err
+}
+
+func (w *DiskWatch) addEvent(name string, tp int) {
+	if name == "" {
+		return
+	}
+	if w.pattern != "" {
+		match, _ := filepath.Match(w.pattern, name)
+		if !match {
+			return
+		}
+	}
+
+	path := filepath.Join(w.dir, name)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, p := range w.readers {
+		p.add(path, tp)
+	}
+
+	w.last_event_tick = OsTicks()
+}
+
+func _DiskWatch_sortedKeys(mp map[string]bool) []string {
+	list := make([]string, 0, len(mp))
+	for k := range mp {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// returns events, which 'reader' hasn't read yet, only after nothing has changed for 'debounce_ms'. First call registers reader.
+func (w *DiskWatch) Get(reader string, debounce_ms int) (DiskWatchEvents, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	p, found := w.readers[reader]
+	if !found {
+		w.readers[reader] = NewDiskWatchPending()
+		return DiskWatchEvents{}, false
+	}
+
+	if p.isEmpty() {
+		return DiskWatchEvents{}, false
+	}
+	if OsIsTicksIn(w.last_event_tick, debounce_ms) {
+		return DiskWatchEvents{}, false //still changing
+	}
+
+	ev := DiskWatchEvents{
+		Created:  _DiskWatch_sortedKeys(p.created),
+		Modified: _DiskWatch_sortedKeys(p.modified),
+		Deleted:  _DiskWatch_sortedKeys(p.deleted),
+	}
+
+	//reset
+	w.readers[reader] = NewDiskWatchPending()
+
+	return ev, true
+}
+
+// removes readers with 'prefix', which are not in 'active'(reader -> path). Returns number of remaining readers
+func (w *DiskWatch) removeReaders(prefix string, path string, active map[string]string) int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for reader := range w.readers {
+		if strings.HasPrefix(reader, prefix) && active[reader] != path {
+			delete(w.readers, reader)
+		}
+	}
+	return len(w.readers)
+}
+
+func (disk *Disk) OpenWatch(path string) (*DiskWatch, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is empty")
+	}
+
+	disk.lock.Lock()
+	defer disk.lock.Unlock()
+
+	w, found := disk.watches[path]
+	if found && w.GetError() != nil && !OsIsTicksIn(w.start_tick, 2000) {
+		//try again(folder may be created later)
+		w.Destroy()
+		found = false
+	}
+
+	if !found {
+		w = NewDiskWatch(path)
+		disk.watches[path] = w
+	}
+
+	return w, w.GetError()
+}
+
+// unregisters readers of one app whose node was deleted, renamed or its path changed. Watches without readers are closed
+func (disk *Disk) UpdateWatchReaders(prefix string, active map[string]string) {
+	disk.lock.Lock()
+	defer disk.lock.Unlock()
+
+	for path, w := range disk.watches {
+		if w.removeReaders(prefix, path, active) == 0 {
+			w.Destroy()
+			delete(disk.watches, path)
+		}
+	}
+}
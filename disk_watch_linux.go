@@ -0,0 +1,77 @@
+//go:build linux
+
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+func (w *DiskWatch) run() {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		w.setError(fmt.Errorf("InotifyInit1() failed: %w", err))
+		return
+	}
+	defer syscall.Close(fd)
+
+	mask := uint32(syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_DELETE | syscall.IN_MOVED_FROM)
+	_, err = syscall.InotifyAddWatch(fd, w.dir, mask)
+	if err != nil {
+		w.setError(fmt.Errorf("InotifyAddWatch(%s) failed: %w", w.dir, err))
+		return
+	}
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for !w.stop.Load() {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			w.setError(fmt.Errorf("Read() failed: %w", err))
+			return
+		}
+
+		offset := 0
+		for offset+syscall.SizeofInotifyEvent <= n {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			end := start + int(ev.Len)
+			if end > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[start:end]), "\x00")
+			offset = end
+
+			switch {
+			case ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+				w.addEvent(name, DiskWatch_CREATED)
+			case ev.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+				w.addEvent(name, DiskWatch_DELETED)
+			case ev.Mask&(syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE) != 0:
+				w.addEvent(name, DiskWatch_MODIFIED)
+			}
+		}
+	}
+}
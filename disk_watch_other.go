@@ -0,0 +1,83 @@
+//go:build !linux
+
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+type _DiskWatchFile struct {
+	time int64
+	size int64
+}
+
+func _DiskWatch_list(dir string) (map[string]_DiskWatchFile, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make(map[string]_DiskWatchFile)
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil {
+			continue //deleted in meantime
+		}
+		list[f.Name()] = _DiskWatchFile{time: info.ModTime().UnixNano(), size: info.Size()}
+	}
+	return list, nil
+}
+
+// polling fallback
+func (w *DiskWatch) run() {
+	last, err := _DiskWatch_list(w.dir)
+	if err != nil {
+		w.setError(fmt.Errorf("ReadDir(%s) failed: %w", w.dir, err))
+		return
+	}
+
+	for !w.stop.Load() {
+		time.Sleep(500 * time.Millisecond)
+
+		act, err := _DiskWatch_list(w.dir)
+		if err != nil {
+			w.setError(fmt.Errorf("ReadDir(%s) failed: %w", w.dir, err))
+			return
+		}
+
+		for name, f := range act {
+			old, found := last[name]
+			if !found {
+				w.addEvent(name, DiskWatch_CREATED)
+			} else if old != f {
+				w.addEvent(name, DiskWatch_MODIFIED)
+			}
+		}
+		for name := range last {
+			_, found := act[name]
+			if !found {
+				w.addEvent(name, DiskWatch_DELETED)
+			}
+		}
+
+		last = act
+	}
+}
@@ -50,13 +50,18 @@ type SAApp struct {
 
 	Selected_canvas SANodePath
 
+	Chat *SAChatBackend `json:",omitempty"` //nil = global from Settings
+
 	root *SANode
 	exe  *SANode //root.exe
 
 	graph  *SAGraph
 	canvas SACanvas
 
-	mic_nodes []SANodePath
+	mic_nodes   []SANodePath
+	mic_streams []SANodePath //nodes with live transcription
+
+	audio_nodes []*SANode //audio_player nodes with device
 
 	all_nodes      []*SANode
 	selected_nodes []*SANode
@@ -94,6 +99,13 @@ func (app *SAApp) GetJsonPath() string {
 	return app.GetFolderPath() + "app.json"
 }
 
+// nodes are loaded when app is opened first time
+func (app *SAApp) loadRoot() {
+	if app.root == nil {
+		app.root, app.exe, _ = NewSANodeRoot(app.GetJsonPath(), app) //err ...
+	}
+}
+
 func (app *SAApp) AddMicNode(nodePath SANodePath) {
 	app.mic_nodes = append(app.mic_nodes, nodePath)
 }
@@ -114,6 +126,41 @@ func (app *SAApp) IsMicNodeRecording(nodePath SANodePath) bool {
 	}
 	return false
 }
+func (app *SAApp) AddMicStream(nodePath SANodePath) {
+	for _, pt := range app.mic_streams {
+		if pt.Cmp(nodePath) {
+			return //previous stream is still finishing
+		}
+	}
+	app.mic_streams = append(app.mic_streams, nodePath)
+}
+func (app *SAApp) IsMicStreamRecording(nodePath SANodePath) bool {
+	for _, pt := range app.mic_streams {
+		if pt.Cmp(nodePath) {
+			nd := pt.Find(app.root)
+			return nd != nil && nd.mic_stream != nil && nd.mic_stream.recording
+		}
+	}
+	return false
+}
+func (app *SAApp) tickMicStreams() {
+	for i := len(app.mic_streams) - 1; i >= 0; i-- {
+		nd := app.mic_streams[i].Find(app.root)
+		if nd != nil && nd.mic_stream != nil {
+			st := nd.mic_stream
+			if st.recording && st.IsInjected() && !st.tickInject(nd) {
+				UiMicrophone_stop(nd) //end of file
+			}
+			if st.Tick(nd) {
+				continue
+			}
+			nd.mic_stream = nil
+		}
+		//un-register
+		app.mic_streams = append(app.mic_streams[:i], app.mic_streams[i+1:]...) //remove
+	}
+}
+
 func (app *SAApp) AddMic(data audio.IntBuffer) {
 	for i := len(app.mic_nodes) - 1; i >= 0; i-- {
 		nd := app.mic_nodes[i].Find(app.root)
@@ -121,6 +168,9 @@ func (app *SAApp) AddMic(data audio.IntBuffer) {
 			nd.temp_mic_data.SourceBitDepth = data.SourceBitDepth
 			nd.temp_mic_data.Format = data.Format
 			nd.temp_mic_data.Data = append(nd.temp_mic_data.Data, data.Data...)
+			if nd.mic_stream != nil && !nd.mic_stream.IsInjected() {
+				nd.mic_stream.Add(nd, data.Data)
+			}
 
 		} else {
 			//un-register
@@ -147,6 +197,11 @@ func (app *SAApp) rebuildLists() {
 	app.selected_nodes = app.buildNodes(app.root, true)
 }
 
+// readers of watched folders are "app name/node path"
+func (app *SAApp) getWatchPrefix() string {
+	return app.Name + "/"
+}
+
 func (app *SAApp) TryExecute() {
 	ui := app.base.ui
 
@@ -181,14 +236,31 @@ func (app *SAApp) TryExecute() {
 			if err == nil {
 				tm := db.GetTime()
 				if !tm.Cmp(&nd.db_time) {
-					fmt.Printf("Db '%s' has changed\n", nd.Name)
+					tables, all := db.GetChangedTables(nd.db_time)
+					fmt.Printf("Db '%s' has changed(tables: %v, all: %v)\n", nd.Name, tables, all)
 					nd.db_time = tm
-					nd.SetChange(nil)
+					nd.SetDbChange(tables, all)
 				}
 			}
 		}
 	}
 
+	//update "changed" for watched folders
+	watches := make(map[string]string)
+	for _, nd := range app.all_nodes {
+		if nd.IsTypeWatch() {
+			nd.checkWatch(watches)
+		}
+	}
+	app.base.ui.win.disk.UpdateWatchReaders(app.getWatchPrefix(), watches)
+
+	//requests from outside
+	for _, nd := range app.all_nodes {
+		if nd.IsTypeWebhook() {
+			nd.checkWebhook()
+		}
+	}
+
 	if app.ExePos < 0 {
 		return
 	}
@@ -0,0 +1,130 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"math"
+)
+
+const SAAudioVad_frameMs = 20
+const SAAudioVad_prerollMs = 200 //kept before speech starts, so first syllable isn't cut
+
+// Energy based voice-activity detection. Cuts mono int16 samples into utterances.
+type SAAudioVad struct {
+	sample_rate int
+
+	Threshold  float64 //RMS(0-1) of speech frame
+	Silence_ms int     //end of utterance
+	Min_ms     int     //shorter are ignored(clicks)
+	Max_ms     int     //longer are cut
+
+	frame []int //not full frame
+
+	speech     []int
+	in_speech  bool
+	silence_fr int
+	preroll    []int
+}
+
+func NewSAAudioVad(sample_rate int) *SAAudioVad {
+	return &SAAudioVad{sample_rate: sample_rate, Threshold: 0.02, Silence_ms: 600, Min_ms: 300, Max_ms: 15000}
+}
+
+func (vad *SAAudioVad) msToSamples(ms int) int {
+	return vad.sample_rate * ms / 1000
+}
+
+func SAAudioVad_rms(samples []int) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range samples {
+		f := float64(v) / 32768
+		sum += f * f
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// returns finished utterances
+func (vad *SAAudioVad) Add(samples []int) [][]int {
+	var out [][]int
+
+	frameSize := vad.msToSamples(SAAudioVad_frameMs)
+	vad.frame = append(vad.frame, samples...)
+	for len(vad.frame) >= frameSize {
+		fr := vad.frame[:frameSize]
+		vad.frame = vad.frame[frameSize:]
+
+		utt := vad.addFrame(fr)
+		if utt != nil {
+			out = append(out, utt)
+		}
+	}
+	return out
+}
+
+func (vad *SAAudioVad) addFrame(fr []int) []int {
+	voice := SAAudioVad_rms(fr) >= vad.Threshold
+
+	if !vad.in_speech {
+		if voice {
+			vad.in_speech = true
+			vad.silence_fr = 0
+			vad.speech = append(append([]int(nil), vad.preroll...), fr...)
+			vad.preroll = nil
+		} else {
+			vad.preroll = append(vad.preroll, fr...)
+			if n := vad.msToSamples(SAAudioVad_prerollMs); len(vad.preroll) > n {
+				vad.preroll = vad.preroll[len(vad.preroll)-n:]
+			}
+		}
+		return nil
+	}
+
+	vad.speech = append(vad.speech, fr...)
+	if voice {
+		vad.silence_fr = 0
+	} else {
+		vad.silence_fr++
+	}
+
+	if vad.silence_fr*SAAudioVad_frameMs >= vad.Silence_ms || len(vad.speech) >= vad.msToSamples(vad.Max_ms) {
+		return vad.cut()
+	}
+	return nil
+}
+
+func (vad *SAAudioVad) cut() []int {
+	utt := vad.speech
+	vad.speech = nil
+	vad.in_speech = false
+	vad.silence_fr = 0
+
+	if len(utt) < vad.msToSamples(vad.Min_ms) {
+		return nil
+	}
+	return utt
+}
+
+// returns unfinished utterance, when recording stops
+func (vad *SAAudioVad) Flush() []int {
+	if !vad.in_speech {
+		return nil
+	}
+	return vad.cut()
+}
@@ -40,6 +40,7 @@ type SABase struct {
 
 	services *SAServices
 	jobs     *SAJobs
+	secrets  *SASecrets
 }
 
 func NewSABase(ui *Ui) (*SABase, error) {
@@ -50,6 +51,7 @@ func NewSABase(ui *Ui) (*SABase, error) {
 
 	base.services = NewSAServices(base)
 	base.jobs = NewSAJobs(base)
+	base.secrets = NewSASecrets()
 
 	//open
 	{
@@ -70,6 +72,8 @@ func NewSABase(ui *Ui) (*SABase, error) {
 
 	base.Refresh()
 
+	base.jobs.restoreJournal()
+
 	return base, nil
 }
 
@@ -226,6 +230,11 @@ func (base *SABase) tickMick() {
 }
 
 func (base *SABase) Tick() {
+	for _, app := range base.Apps {
+		app.tickMicStreams()
+		app.tickAudio()
+		app.tickWebhooks()
+	}
 	base.tickMick()
 }
 
@@ -252,6 +261,7 @@ func (base *SABase) Render() bool {
 	//canvas
 	if base.HasApp() {
 		app.rebuildLists() //!!!
+		app.ResolveBinds()
 
 		ui.Div_startName(1, 0, 1, 1, base.Apps[base.Selected].Name)
 		{
@@ -366,8 +376,6 @@ func (base *SABase) Render() bool {
 
 func (base *SABase) GetApp() *SAApp {
 	app := base.Apps[base.Selected]
-	if app.root == nil {
-		app.root, app.exe, _ = NewSANodeRoot(app.GetJsonPath(), app) //err ...
-	}
+	app.loadRoot()
 	return app
 }
@@ -421,6 +421,16 @@ func (gr *SAGraph) drawConnections() {
 			gr.drawConnectionDirect(coordOut, coordIn, 0, in.node.Selected || out.Selected, 0, OsTrnFloat(in.updated && in.write, 0.5, -1), true, true)
 		}
 
+		//bindings connection
+		for _, in := range out.getBindSources() {
+			coordIn, selCoordIn, _ := in.nodeToPixelsCoord(lv.call.canvas)
+			if in.Selected {
+				coordIn = selCoordIn
+			}
+
+			gr.drawConnectionDirect(coordOut, coordIn, gr.app.root.cellZoom(ui)*0.3, in.Selected || out.Selected, 0, 0.5, true, true)
+		}
+
 		/*for _, inName := range out.Code.Triggers {
 
 			in := out.FindNode(inName)
@@ -64,6 +64,7 @@ func InitSAGroups() SAGroups {
 		{name: "timer", render: UiTimer_render, attrs: UiTimer_Attrs},
 		{name: "date", render: UiDate_render, attrs: UiDate_Attrs},
 		{name: "microphone", render: UiMicrophone_render, attrs: UiMicrophone_Attrs},
+		{name: "audio_player", render: UiAudioPlayer_render, attrs: UiAudioPlayer_Attrs},
 		{name: "map", render: UiMap_render, attrs: UiMap_Attrs},
 		{name: "layout", render: UiLayout_render, attrs: UiLayout_Attrs},
 		{name: "list", render: UiList_render, attrs: UiList_Attrs},
@@ -76,12 +77,18 @@ func InitSAGroups() SAGroups {
 		{name: "disk_file", render: UiDiskFile_render, attrs: UiDiskFile_Attrs},
 		{name: "db_file", render: UiSQLite_render, attrs: UiSQLite_Attrs},
 		{name: "net", attrs: UiNet_Attrs},
+		{name: "http", attrs: UiHttp_Attrs},
+		{name: "watch", attrs: UiWatch_Attrs},
+		{name: "webhook", attrs: UiWebhook_Attrs},
 	}})
 
 	grs.groups = append(grs.groups, &SAGroup{name: "Neural networks", icon: InitWinMedia_url(path + "node_nn.png"), nodes: []*SAGroupNode{
 		{name: "whispercpp", attrs: UiWhisperCpp_Attrs},
+		{name: "tts", attrs: UiTTS_Attrs},
 		{name: "llamacpp", attrs: UiLLamaCpp_Attrs},
 		{name: "openai", attrs: UiOpenAI_Attrs},
+		{name: "embeddings", attrs: UiEmbeddings_Attrs},
+		{name: "prompt", attrs: UiPrompt_Attrs},
 	}})
 
 	grs.groups = append(grs.groups, &SAGroup{name: "Functions", icon: InitWinMedia_url(path + "node_code.png"), nodes: []*SAGroupNode{
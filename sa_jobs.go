@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -58,23 +59,19 @@ func (st *SAJobTimeStat) Add(tm_sec float64) {
 }
 
 type SAJobCompile struct {
-	jobs    *SAJobs
-	st_time float64
+	SAJobCommon
+	jobs *SAJobs
 
-	app      *SAApp
-	node     SANodePath
 	dirPath  string //temp/go/
 	fileName string //xzy.go
 
 	output []byte
-	outErr error
 
 	dt_time float64
-	done    atomic.Bool
 }
 
 func NewSAJobCompile(app *SAApp, node SANodePath, dirPath string, fileName string, jobs *SAJobs) *SAJobCompile {
-	jb := &SAJobCompile{jobs: jobs, st_time: OsTime()}
+	jb := &SAJobCompile{jobs: jobs}
 
 	jb.app = app
 	jb.node = node
@@ -87,7 +84,7 @@ func NewSAJobCompile(app *SAApp, node SANodePath, dirPath string, fileName strin
 func (jb *SAJobCompile) Run() {
 	defer jb.done.Store(true)
 
-	cmd := exec.Command("go", "build", jb.fileName)
+	cmd := exec.CommandContext(jb.ctx, "go", "build", jb.fileName)
 	cmd.Dir = jb.dirPath
 
 	var err error
@@ -122,17 +119,25 @@ func (jb *SAJobCompile) PostRun() {
 	}
 
 	node.Code.file_err = jb.outErr
+	if node.Code.job_compile == jb {
+		node.Code.job_compile = nil
+		node.Code.fixCompiled()
+	}
 
 	fmt.Printf("SAJobCompile '%s' finished in %f\n", jb.fileName, jb.dt_time)
 }
+func (jb *SAJobCompile) GetLog() string {
+	return string(jb.output)
+}
+func (jb *SAJobCompile) clone() SAJob {
+	return NewSAJobCompile(jb.app, jb.node, jb.dirPath, jb.fileName, jb.jobs)
+}
 
 type SAJobExe struct {
-	jobs    *SAJobs
-	st_time float64
+	SAJobCommon
+	jobs *SAJobs
 
 	job_id      string
-	app         *SAApp
-	node        SANodePath
 	dirPath     string //temp/go/
 	programName string //xzy
 
@@ -140,14 +145,14 @@ type SAJobExe struct {
 
 	outJs  []byte
 	outCmd []byte
-	outErr error
+
+	only_result bool //LLM tool or auto-fix test, output is not applied to node
 
 	dt_time float64
-	done    atomic.Bool
 }
 
 func NewSAJobExe(job_id string, app *SAApp, node SANodePath, dirPath string, programName string, input []byte, jobs *SAJobs) *SAJobExe {
-	jb := &SAJobExe{jobs: jobs, st_time: OsTime()}
+	jb := &SAJobExe{jobs: jobs}
 
 	jb.job_id = job_id
 	jb.app = app
@@ -162,7 +167,7 @@ func NewSAJobExe(job_id string, app *SAApp, node SANodePath, dirPath string, pro
 func (jb *SAJobExe) Run() {
 	defer jb.done.Store(true)
 
-	cmd := exec.Command("."+jb.dirPath+jb.programName, strconv.Itoa(jb.jobs.base.services.port), jb.job_id)
+	cmd := exec.CommandContext(jb.ctx, "."+jb.dirPath+jb.programName, strconv.Itoa(jb.jobs.base.services.port), jb.job_id)
 	//cmd.Dir = jb.dirPath
 
 	cmd_out, err := cmd.CombinedOutput()
@@ -191,6 +196,14 @@ func (jb *SAJobExe) RenderProgress(y *int) bool {
 
 func (jb *SAJobExe) PostRun() {
 
+	if jb.only_result {
+		if node := jb.node.Find(jb.app.root); node != nil && node.Code.fix.job == jb {
+			node.Code.fixExecuted(jb.outErr)
+		}
+		fmt.Printf("SAJobExe '%s'(isolated) finished in %f\n", jb.programName, jb.dt_time)
+		return
+	}
+
 	node := jb.node.Find(jb.app.root)
 	if node == nil {
 		fmt.Printf("Warning: SAJobExe node '%s' not found\n", jb.node.String())
@@ -200,32 +213,38 @@ func (jb *SAJobExe) PostRun() {
 	node.Code.cmd_output = string(jb.outCmd)
 	if jb.outErr == nil {
 		node.Code.SetOutput(jb.outJs)
+		node.Code.exe_outJs = jb.outJs //memoize
 	} else {
 		node.Code.exe_err = jb.outErr
+		node.Code.ResetMemo()
 	}
 
 	fmt.Printf("SAJobExe '%s' finished in %f\n", jb.programName, jb.dt_time)
 }
+func (jb *SAJobExe) GetLog() string {
+	return string(jb.outCmd)
+}
+func (jb *SAJobExe) clone() SAJob {
+	nj := NewSAJobExe("", jb.app, jb.node, jb.dirPath, jb.programName, jb.input, jb.jobs) //job_id is set by SAJobs.Retry()
+	nj.only_result = jb.only_result
+	return nj
+}
 
 type SAJobWhisperCpp struct {
-	jobs    *SAJobs
-	st_time float64
+	SAJobCommon
+	jobs *SAJobs
 
-	app   *SAApp
-	node  SANodePath
 	model string
 	blob  OsBlob
 	props *SAServiceWhisperCppProps
 
 	output []byte
-	outErr error
 
 	dt_time float64
-	done    atomic.Bool
 }
 
 func NewSAJobWhisperCpp(app *SAApp, node SANodePath, model string, blob OsBlob, props *SAServiceWhisperCppProps, jobs *SAJobs) *SAJobWhisperCpp {
-	jb := &SAJobWhisperCpp{jobs: jobs, st_time: OsTime()}
+	jb := &SAJobWhisperCpp{jobs: jobs}
 
 	jb.app = app
 	jb.node = node
@@ -238,12 +257,7 @@ func NewSAJobWhisperCpp(app *SAApp, node SANodePath, model string, blob OsBlob,
 func (jb *SAJobWhisperCpp) Run() {
 	defer jb.done.Store(true)
 
-	wh, err := jb.jobs.getWhisper(jb.model)
-	if err == nil {
-		jb.output, jb.outErr = wh.Transcribe(jb.model, jb.blob, jb.props)
-	} else {
-		jb.outErr = err
-	}
+	jb.output, jb.outErr = jb.jobs.getWhisper(jb.model).Transcribe(jb.ctx, jb.model, jb.blob, jb.props)
 
 	jb.dt_time = OsTime() - jb.st_time
 }
@@ -264,46 +278,142 @@ func (jb *SAJobWhisperCpp) RenderProgress(y *int) bool {
 func (jb *SAJobWhisperCpp) PostRun() {
 	fmt.Printf("SAJobWhisperCpp '%s' finished in %f\n", jb.node.String(), jb.dt_time)
 }
+func (jb *SAJobWhisperCpp) GetLog() string {
+	return string(jb.output)
+}
+func (jb *SAJobWhisperCpp) clone() SAJob {
+	return NewSAJobWhisperCpp(jb.app, jb.node, jb.model, jb.blob, jb.props, jb.jobs)
+}
+
+type SAJobTTS struct {
+	SAJobCommon
+	jobs *SAJobs
+
+	voice string
+	text  string
+	props *SAServiceTTSProps
+
+	output []byte //WAV
+
+	dt_time float64
+}
+
+func NewSAJobTTS(app *SAApp, node SANodePath, voice string, text string, props *SAServiceTTSProps, jobs *SAJobs) *SAJobTTS {
+	jb := &SAJobTTS{jobs: jobs}
+
+	jb.app = app
+	jb.node = node
+	jb.voice = voice
+	jb.text = text
+	jb.props = props
+
+	return jb
+}
+func (jb *SAJobTTS) Run() {
+	defer jb.done.Store(true)
+
+	jb.output, jb.outErr = jb.jobs.getTTS(jb.voice).Speak(jb.ctx, jb.voice, jb.text, jb.props)
+
+	jb.dt_time = OsTime() - jb.st_time
+}
+func (jb *SAJobTTS) GetProgress() (string, float64) {
+	dt := OsTime() - jb.st_time
+	return fmt.Sprintf("Speaking %s", jb.voice), dt / jb.jobs.compile_stats.time_avg //.........
+}
+func (jb *SAJobTTS) RenderProgress(y *int) bool {
+	ui := jb.jobs.base.ui
+
+	str, proc := jb.GetProgress()
+	ui.Comp_text(0, *y, 1, 1, fmt.Sprintf("%s ... %.1f%%", str, proc*100), 0)
+	(*y)++
+
+	return true
+}
+
+func (jb *SAJobTTS) PostRun() {
+	fmt.Printf("SAJobTTS '%s' finished in %f\n", jb.node.String(), jb.dt_time)
+}
+func (jb *SAJobTTS) GetLog() string {
+	str := jb.text
+	if jb.output != nil {
+		str += fmt.Sprintf("\n\n%.1fKB WAV", float64(len(jb.output))/1024)
+	}
+	return str
+}
+func (jb *SAJobTTS) clone() SAJob {
+	return NewSAJobTTS(jb.app, jb.node, jb.voice, jb.text, jb.props, jb.jobs)
+}
 
 type SAJobLLamaCpp struct {
-	jobs    *SAJobs
-	st_time float64
+	SAJobCommon
+	jobs *SAJobs
 
-	app   *SAApp
-	node  SANodePath
 	props *SAServiceLLamaCppProps
+	tools *SAServicesTools //optional
+
+	messages []SAServiceMsg //original, props.Messages are extended by tool calls
+
+	wip_answer SAServiceAnswer
+	stop       atomic.Bool
 
-	wip_answer string //atomic ...
-	stop       bool   //atomic ...
+	usage SAServiceUsage
 
 	output []byte
-	outErr error
 
 	dt_time float64
-	done    atomic.Bool
 }
 
-func NewSAJobLLamaCpp(app *SAApp, node SANodePath, props *SAServiceLLamaCppProps, jobs *SAJobs) *SAJobLLamaCpp {
-	jb := &SAJobLLamaCpp{jobs: jobs, st_time: OsTime()}
+func NewSAJobLLamaCpp(app *SAApp, node SANodePath, props *SAServiceLLamaCppProps, tools *SAServicesTools, jobs *SAJobs) *SAJobLLamaCpp {
+	jb := &SAJobLLamaCpp{jobs: jobs}
 
 	jb.app = app
 	jb.node = node
 	jb.props = props
+	jb.tools = tools
+	jb.messages = append([]SAServiceMsg(nil), props.Messages...)
 
 	return jb
 }
 func (jb *SAJobLLamaCpp) Run() {
 	defer jb.done.Store(true)
 
-	wh, err := jb.jobs.getLLama(jb.props.Model)
+	llama, err := jb.jobs.getLLama(jb.props.Model, false, &jb.stop)
 	if err == nil {
-		jb.output, jb.outErr = wh.Complete(jb.props, &jb.wip_answer, &jb.stop)
+		ctx := llama.NewContext(jb.props, &jb.stop)
+		jb.output, jb.outErr = jb.tools.Run(&jb.props.Messages, &jb.stop, func() ([]byte, []SAServiceToolCall, error) {
+			var round SAServiceUsage
+			props := *jb.props
+			props.Messages, err = ctx.Fit(jb.props.Messages, &round)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Fit() failed: %w", err)
+			}
+
+			out, calls, err := llama.Complete(&props, &jb.wip_answer, &jb.stop)
+			if err == nil {
+				round.Completion_tokens, _ = ctx.count(string(out))
+				jb.usage.Add(&round)
+			}
+			return out, calls, err
+		})
+		llama.Release()
 	} else {
 		jb.outErr = err
 	}
 
 	jb.dt_time = OsTime() - jb.st_time
 }
+func (jb *SAJobLLamaCpp) GetWipAnswer() string {
+	return jb.wip_answer.Get()
+}
+func (jb *SAJobLLamaCpp) GetOutput() ([]byte, error) {
+	return jb.output, jb.outErr
+}
+func (jb *SAJobLLamaCpp) IsDone() bool {
+	return jb.done.Load()
+}
+func (jb *SAJobLLamaCpp) Stop() {
+	jb.stop.Store(true)
+}
 func (jb *SAJobLLamaCpp) GetProgress() (string, float64) {
 	dt := OsTime() - jb.st_time
 	return fmt.Sprintf("llama is completing"), dt / jb.jobs.compile_stats.time_avg //.........
@@ -315,11 +425,11 @@ func (jb *SAJobLLamaCpp) RenderProgress(y *int) bool {
 	ui.Comp_text(0, *y, 1, 1, fmt.Sprintf("%s ... %.1f%%", str, proc*100), 0)
 	(*y)++
 
-	ui.Comp_textSelectMulti(0, *y, 1, 5, jb.wip_answer, 1.0, OsV2{0, 0}, true, true, false, true)
+	ui.Comp_textSelectMulti(0, *y, 1, 5, jb.wip_answer.Get(), 1.0, OsV2{0, 0}, true, true, false, true)
 	*y = *y + 5
 
 	if ui.Comp_button(0, *y, 1, 1, "Stop", Comp_buttonProp().SetError(true)) > 0 {
-		jb.stop = true
+		jb.stop.Store(true)
 	}
 	(*y)++
 
@@ -327,33 +437,60 @@ func (jb *SAJobLLamaCpp) RenderProgress(y *int) bool {
 }
 
 func (jb *SAJobLLamaCpp) PostRun() {
+	if jb.outErr == nil {
+		jb.jobs.setNodeAnswer(jb.app, jb.node, string(jb.output))
+	}
+	jb.jobs.setNodeUsage(jb.app, jb.node, &jb.usage)
+
+	//code assistant
+	if node := jb.node.Find(jb.app.root); node != nil && node.Code.job_chat == SAJobChat(jb) {
+		node.Code.finishAnswer()
+	}
 	fmt.Printf("SAJobLLamaCpp '%s' finished in %f\n", jb.node.String(), jb.dt_time)
 }
+func (jb *SAJobLLamaCpp) GetLog() string {
+	if jb.output != nil {
+		return string(jb.output)
+	}
+	return jb.wip_answer.Get()
+}
+func (jb *SAJobLLamaCpp) clone() SAJob {
+	props := *jb.props
+	props.Messages = append([]SAServiceMsg(nil), jb.messages...)
+	nj := NewSAJobLLamaCpp(jb.app, jb.node, &props, jb.tools, jb.jobs)
+	if jb.tools != nil {
+		jb.tools.parent = nj
+	}
+	return nj
+}
 
 type SAJobOpenAI struct {
-	jobs    *SAJobs
-	st_time float64
+	SAJobCommon
+	jobs *SAJobs
 
-	app   *SAApp
-	node  SANodePath
 	props *SAServiceOpenAIProps
+	tools *SAServicesTools //optional
+
+	messages []SAServiceMsg //original, props.Messages are extended by tool calls
+
+	wip_answer SAServiceAnswer
+	stop       atomic.Bool
 
-	wip_answer string //atomic ...
-	stop       bool   //atomic ...
+	usage SAServiceUsage
 
 	output []byte
-	outErr error
 
 	dt_time float64
-	done    atomic.Bool
 }
 
-func NewSAJobOpenAI(app *SAApp, node SANodePath, props *SAServiceOpenAIProps, jobs *SAJobs) *SAJobOpenAI {
-	jb := &SAJobOpenAI{jobs: jobs, st_time: OsTime()}
+func NewSAJobOpenAI(app *SAApp, node SANodePath, props *SAServiceOpenAIProps, tools *SAServicesTools, jobs *SAJobs) *SAJobOpenAI {
+	jb := &SAJobOpenAI{jobs: jobs}
 
 	jb.app = app
 	jb.node = node
 	jb.props = props
+	jb.tools = tools
+	jb.messages = append([]SAServiceMsg(nil), props.Messages...)
 
 	return jb
 }
@@ -362,13 +499,43 @@ func (jb *SAJobOpenAI) Run() {
 
 	wh, err := jb.jobs.getOpenAI()
 	if err == nil {
-		jb.output, jb.outErr = wh.Complete(jb.props, &jb.wip_answer, &jb.stop)
+		ctx := wh.NewContext(jb.props, &jb.stop)
+		jb.output, jb.outErr = jb.tools.Run(&jb.props.Messages, &jb.stop, func() ([]byte, []SAServiceToolCall, error) {
+			var round SAServiceUsage
+			props := *jb.props
+			props.Messages, err = ctx.Fit(jb.props.Messages, &round)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Fit() failed: %w", err)
+			}
+
+			out, calls, err := wh.Complete(&props, &jb.wip_answer, &jb.stop)
+			if err == nil {
+				round.Completion_tokens, _ = ctx.count(string(out))
+				if props.IsDefaultUrl() {
+					round.Cost = SAServiceOpenAI_getCost(props.Model, round.Prompt_tokens, round.Completion_tokens)
+				}
+				jb.usage.Add(&round)
+			}
+			return out, calls, err
+		})
 	} else {
 		jb.outErr = err
 	}
 
 	jb.dt_time = OsTime() - jb.st_time
 }
+func (jb *SAJobOpenAI) GetWipAnswer() string {
+	return jb.wip_answer.Get()
+}
+func (jb *SAJobOpenAI) GetOutput() ([]byte, error) {
+	return jb.output, jb.outErr
+}
+func (jb *SAJobOpenAI) IsDone() bool {
+	return jb.done.Load()
+}
+func (jb *SAJobOpenAI) Stop() {
+	jb.stop.Store(true)
+}
 func (jb *SAJobOpenAI) GetProgress() (string, float64) {
 	dt := OsTime() - jb.st_time
 	return fmt.Sprintf("openAI is completing"), dt / jb.jobs.compile_stats.time_avg //.........
@@ -380,26 +547,164 @@ func (jb *SAJobOpenAI) RenderProgress(y *int) bool {
 	ui.Comp_text(0, *y, 1, 1, fmt.Sprintf("%s ... %.1f%%", str, proc*100), 0)
 	(*y)++
 
-	ui.Comp_textSelectMulti(0, *y, 1, 5, jb.wip_answer, 1.0, OsV2{0, 0}, true, true, false, true)
+	ui.Comp_textSelectMulti(0, *y, 1, 5, jb.wip_answer.Get(), 1.0, OsV2{0, 0}, true, true, false, true)
 	*y = *y + 5
 
 	if ui.Comp_button(0, *y, 1, 1, "Stop", Comp_buttonProp().SetError(true)) > 0 {
-		jb.stop = true
+		jb.stop.Store(true)
 	}
 	(*y)++
 
 	return true
 }
 func (jb *SAJobOpenAI) PostRun() {
+	if jb.outErr == nil {
+		jb.jobs.setNodeAnswer(jb.app, jb.node, string(jb.output))
+	}
+	jb.jobs.setNodeUsage(jb.app, jb.node, &jb.usage)
+
+	//code assistant
+	if node := jb.node.Find(jb.app.root); node != nil && node.Code.job_chat == SAJobChat(jb) {
+		node.Code.finishAnswer()
+	}
 	fmt.Printf("SAJobOpenAI '%s' finished in %f\n", jb.node.String(), jb.dt_time)
 }
+func (jb *SAJobOpenAI) GetLog() string {
+	if jb.output != nil {
+		return string(jb.output)
+	}
+	return jb.wip_answer.Get()
+}
+func (jb *SAJobOpenAI) clone() SAJob {
+	props := *jb.props
+	props.Messages = append([]SAServiceMsg(nil), jb.messages...)
+	nj := NewSAJobOpenAI(jb.app, jb.node, &props, jb.tools, jb.jobs)
+	if jb.tools != nil {
+		jb.tools.parent = nj
+	}
+	return nj
+}
+
+type SAJobEmbeddings struct {
+	SAJobCommon
+	jobs *SAJobs
+
+	props *SAServiceEmbeddingsProps
+	llama bool //props.Url is set from llama.cpp server
+	db    *DiskDb
+	table string
+
+	op        string //"ingest", "search"
+	src_table string
+	column    string
+	query     string
+	k         int
+
+	done_rows  atomic.Int64
+	total_rows atomic.Int64
+	stop       atomic.Bool
+
+	output []byte
+
+	dt_time float64
+}
+
+func NewSAJobEmbeddings(app *SAApp, node SANodePath, props *SAServiceEmbeddingsProps, llama bool, db *DiskDb, table string, jobs *SAJobs) *SAJobEmbeddings {
+	jb := &SAJobEmbeddings{jobs: jobs}
+
+	jb.app = app
+	jb.node = node
+	jb.props = props
+	jb.llama = llama
+	jb.db = db
+	jb.table = table
+
+	return jb
+}
+func (jb *SAJobEmbeddings) Run() {
+	defer jb.done.Store(true)
+
+	jb.outErr = jb.run()
+	jb.dt_time = OsTime() - jb.st_time
+}
+func (jb *SAJobEmbeddings) run() error {
+	props := *jb.props //props are shared with clone()
+	if jb.llama {
+		llama, err := jb.jobs.getLLama(props.Model, true, &jb.stop)
+		if err != nil {
+			return err
+		}
+		defer llama.Release()
+		props.Url = llama.getAddr() + "v1/"
+		props.local = true
+	}
+
+	emb := jb.jobs.getEmbeddings()
+
+	var err error
+	switch jb.op {
+	case "ingest":
+		var n int
+		n, err = emb.Ingest(&props, jb.db, jb.table, jb.src_table, jb.column, &jb.stop, &jb.done_rows, &jb.total_rows)
+		if err == nil {
+			jb.output, err = json.Marshal(map[string]int{"embedded": n})
+		}
+	case "search":
+		var results []SAServiceEmbeddingsResult
+		results, err = emb.Search(&props, jb.db, jb.table, jb.query, jb.k, &jb.stop)
+		if err == nil {
+			jb.output, err = json.Marshal(results)
+		}
+	default:
+		err = fmt.Errorf("unknown operation '%s'", jb.op)
+	}
+	return err
+}
+func (jb *SAJobEmbeddings) GetProgress() (string, float64) {
+	done, total := jb.done_rows.Load(), jb.total_rows.Load()
+	if total > 0 {
+		return fmt.Sprintf("Embedding %d/%d rows", done, total), float64(done) / float64(total)
+	}
+	dt := OsTime() - jb.st_time
+	return fmt.Sprintf("Embeddings %s", jb.op), dt / jb.jobs.compile_stats.time_avg //.........
+}
+func (jb *SAJobEmbeddings) RenderProgress(y *int) bool {
+	ui := jb.jobs.base.ui
+
+	str, proc := jb.GetProgress()
+	ui.Comp_text(0, *y, 1, 1, fmt.Sprintf("%s ... %.1f%%", str, proc*100), 0)
+	(*y)++
+
+	if ui.Comp_button(0, *y, 1, 1, "Stop", Comp_buttonProp().SetError(true)) > 0 {
+		jb.stop.Store(true)
+	}
+	(*y)++
+
+	return true
+}
+func (jb *SAJobEmbeddings) PostRun() {
+	fmt.Printf("SAJobEmbeddings '%s' finished in %f\n", jb.node.String(), jb.dt_time)
+}
+func (jb *SAJobEmbeddings) Stop() {
+	jb.stop.Store(true)
+}
+func (jb *SAJobEmbeddings) GetLog() string {
+	return string(jb.output)
+}
+func (jb *SAJobEmbeddings) clone() SAJob {
+	nj := NewSAJobEmbeddings(jb.app, jb.node, jb.props, jb.llama, jb.db, jb.table, jb.jobs)
+	nj.op = jb.op
+	nj.src_table = jb.src_table
+	nj.column = jb.column
+	nj.query = jb.query
+	nj.k = jb.k
+	return nj
+}
 
 type SAJobNet struct {
-	jobs    *SAJobs
-	st_time float64
+	SAJobCommon
+	jobs *SAJobs
 
-	app  *SAApp
-	node SANodePath
 	path string
 	url  string
 
@@ -413,14 +718,12 @@ type SAJobNet struct {
 	stat_recv atomic.Uint64
 
 	//output []byte
-	outErr error
 
 	dt_time float64
-	done    atomic.Bool
 }
 
 func NewSAJobNet(app *SAApp, node SANodePath, path string, url string, jobs *SAJobs) *SAJobNet {
-	jb := &SAJobNet{jobs: jobs, st_time: OsTime()}
+	jb := &SAJobNet{jobs: jobs}
 
 	jb.app = app
 	jb.node = node
@@ -480,24 +783,43 @@ func (jb *SAJobNet) Run() {
 	}
 	defer resp.Body.Close()
 
+	if file_bytes > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		file.Close()
+		OsFileRename(path, jb.path) //file was already downloaded
+		return
+	}
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
 		file.Close()
 		jb.outErr = errors.New(resp.Status)
 		return
 	}
+	if file_bytes > 0 && resp.StatusCode == http.StatusOK {
+		//server doesn't support Range, download from beginning
+		err = file.Truncate(0)
+		if err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			file.Close()
+			jb.outErr = err
+			return
+		}
+		file_bytes = 0
+	}
 	jb.recv_bytes = file_bytes
-	jb.final_bytes = file_bytes + resp.ContentLength
+	jb.final_bytes = -1 //unknown, server didn't send Content-Length
+	if resp.ContentLength >= 0 {
+		jb.final_bytes = file_bytes + resp.ContentLength
+	}
 
 	// Loop
+	eof := false
 	data := make([]byte, 1024*64)
 	for jb.jobs.base.services.online && !jb.stop.Load() && !jb.stop_and_delete.Load() {
 
 		//download
-		n, err := resp.Body.Read(data)
-		if err != nil {
-			jb.outErr = err
-			break
-		}
+		n, rerr := resp.Body.Read(data)
+
 		//save
 		m, err := file.Write(data[:n])
 		if err != nil {
@@ -508,11 +830,31 @@ func (jb *SAJobNet) Run() {
 		jb.recv_bytes += int64(m)
 
 		jb.stat_recv.Add(uint64(m))
+
+		if rerr != nil {
+			if rerr == io.EOF {
+				eof = true
+			} else {
+				jb.outErr = rerr
+			}
+			break
+		}
 	}
 
 	file.Close()
 
-	if jb.recv_bytes == jb.final_bytes {
+	if jb.outErr == nil {
+		if eof && jb.final_bytes >= 0 && jb.recv_bytes != jb.final_bytes {
+			jb.outErr = fmt.Errorf("connection closed after %d of %d bytes", jb.recv_bytes, jb.final_bytes)
+		} else if !eof {
+			jb.outErr = fmt.Errorf("internet is disabled(Menu:Settings:Internet Connection)")
+		}
+	}
+	if jb.stop.Load() || jb.stop_and_delete.Load() {
+		jb.outErr = fmt.Errorf("downloading canceled")
+	}
+
+	if jb.outErr == nil {
 		OsFileRename(path, jb.path) //<name>.temp -> <name>
 	} else {
 		if jb.stop_and_delete.Load() {
@@ -520,10 +862,6 @@ func (jb *SAJobNet) Run() {
 		}
 	}
 
-	if jb.stop.Load() || jb.stop_and_delete.Load() {
-		jb.outErr = fmt.Errorf("downloading canceled")
-	}
-
 	jb.dt_time = OsTime() - jb.st_time
 }
 func (jb *SAJobNet) getProcDone() float64 {
@@ -550,7 +888,7 @@ func (jb *SAJobNet) GetProgress() (string, float64) {
 	speed := jb.getAvgRecvBytesPerSec()
 
 	remain_sec := 0
-	if speed > 0 {
+	if speed > 0 && jb.final_bytes > 0 {
 		remain_sec = int(float64(jb.final_bytes-jb.recv_bytes) / speed)
 	}
 
@@ -588,6 +926,86 @@ func (jb *SAJobNet) RenderProgress(y *int) bool {
 func (jb *SAJobNet) PostRun() {
 	fmt.Printf("SAJobNet '%s' finished in %f\n", jb.url, jb.dt_time)
 }
+func (jb *SAJobNet) Stop() {
+	jb.stop.Store(true)
+}
+func (jb *SAJobNet) GetLog() string {
+	return fmt.Sprintf("%s\n-> %s\n%d / %d bytes", jb.url, jb.path, jb.recv_bytes, jb.final_bytes)
+}
+func (jb *SAJobNet) clone() SAJob {
+	return NewSAJobNet(jb.app, jb.node, jb.path, jb.url, jb.jobs) //continues from .temp file
+}
+
+type SAJobHttp struct {
+	SAJobCommon
+	jobs *SAJobs
+
+	props *SAServiceHttpProps
+	vars  map[string]string
+
+	resp   *SAServiceHttpResponse
+	output []byte //JSON of resp
+
+	dt_time float64
+}
+
+func NewSAJobHttp(app *SAApp, node SANodePath, props *SAServiceHttpProps, vars map[string]string, jobs *SAJobs) *SAJobHttp {
+	jb := &SAJobHttp{jobs: jobs}
+
+	jb.app = app
+	jb.node = node
+	jb.props = props
+	jb.vars = vars
+
+	return jb
+}
+func (jb *SAJobHttp) Run() {
+	defer jb.done.Store(true)
+
+	jb.resp, jb.outErr = SAServiceHttp_send(jb.ctx, jb.props, jb.vars, jb.jobs.base.secrets, jb.jobs.base.services.online)
+	if jb.outErr == nil {
+		jb.output, jb.outErr = json.Marshal(jb.resp)
+	}
+	jb.dt_time = OsTime() - jb.st_time
+}
+func (jb *SAJobHttp) GetProgress() (string, float64) {
+	dt := OsTime() - jb.st_time
+	return fmt.Sprintf("%s '%.30s'", jb.props.Method, jb.props.Url), dt / float64(OsMax(jb.props.Timeout_sec, 1))
+}
+func (jb *SAJobHttp) RenderProgress(y *int) bool {
+	ui := jb.jobs.base.ui
+
+	str, _ := jb.GetProgress()
+	ui.Comp_text(0, *y, 1, 1, str+" ...", 0)
+	(*y)++
+
+	if ui.Comp_button(0, *y, 1, 1, "Stop", Comp_buttonProp().SetError(true)) > 0 {
+		jb.Stop()
+	}
+	(*y)++
+
+	return true
+}
+func (jb *SAJobHttp) PostRun() {
+	//shown in attributes
+	if node := jb.node.Find(jb.app.root); node != nil && node.IsTypeHttp() {
+		if jb.resp != nil {
+			node.http_response = jb.resp.String()
+		} else if jb.outErr != nil {
+			node.http_response = "Error: " + jb.outErr.Error()
+		}
+	}
+	fmt.Printf("SAJobHttp '%s' finished in %f\n", jb.node.String(), jb.dt_time)
+}
+func (jb *SAJobHttp) GetLog() string {
+	if jb.resp != nil {
+		return jb.resp.String()
+	}
+	return ""
+}
+func (jb *SAJobHttp) clone() SAJob {
+	return NewSAJobHttp(jb.app, jb.node, jb.props, jb.vars, jb.jobs)
+}
 
 type SAJobs struct {
 	base *SABase
@@ -595,48 +1013,72 @@ type SAJobs struct {
 	compile_stats SAJobTimeStat
 	exe_stats     SAJobTimeStat
 
-	compiles []*SAJobCompile
-	exes     []*SAJobExe
-	whispers []*SAJobWhisperCpp
-	llamas   []*SAJobLLamaCpp
-	oais     []*SAJobOpenAI
-	nets     []*SAJobNet
+	list      []SAJob //queued, running and finished(until PostRun())
+	last_seq  int
+	app_turns map[*SAApp]int //fairness
+	last_turn int
 
+	recent   []SAJob //finished, for jobs panel
+	selected SAJob   //jobs panel
+
+	supervisor *SAServiceSupervisor
 	whisperCpp *SAServiceWhisperCpp
-	llamaCpp   *SAServiceLLamaCpp
+	tts        *SAServiceTTS
+	llamaCpp   *SAServiceLLamaCppPool
 	oai        *SAServiceOpenAI
+	embeddings *SAServiceEmbeddings
+	cache      *SAServiceCache
 	//net        *SAServiceNet
 
-	lock sync.Mutex
+	lock        sync.Mutex
+	closing     bool   //jobs are interrupted, journal is kept
+	journal_sig string //journaled jobs in last write
+
+	journal_gen  atomic.Int64   //last snapshot
+	journal_lock sync.Mutex     //one write at a time
+	journal_wg   sync.WaitGroup //background writes
 
 	last_job_id int
 }
 
 func NewSAJobs(base *SABase) *SAJobs {
 	jobs := &SAJobs{base: base}
+	jobs.app_turns = make(map[*SAApp]int)
 	jobs.compile_stats = InitSAJobStats(1)
 	jobs.exe_stats = InitSAJobStats(1)
+	jobs.supervisor = NewSAServiceSupervisor(jobs)
+	jobs.llamaCpp = NewSAServiceLLamaCppPool(jobs)
 
 	jobs.last_job_id = int(rand.Int31())
 	return jobs
 }
 
 func (jobs *SAJobs) Destroy() {
+	jobs.lock.Lock()
+	jobs.closing = true
+	jobs.lock.Unlock()
+
+	jobs.journal_wg.Wait()
 
 	//close all the jobs ...........
 
 	if jobs.whisperCpp != nil {
 		jobs.whisperCpp.Destroy()
 	}
-	if jobs.llamaCpp != nil {
-		jobs.llamaCpp.Destroy()
+	if jobs.tts != nil {
+		jobs.tts.Destroy()
 	}
+	jobs.llamaCpp.Destroy()
 	if jobs.oai != nil {
 		jobs.oai.Destroy()
 	}
+	if jobs.embeddings != nil {
+		jobs.embeddings.Destroy()
+	}
 	/*if jobs.net != nil {
 		jobs.net.Destroy()
 	}*/
+	jobs.supervisor.Destroy()
 }
 
 func (jobs *SAJobs) AddCompile(app *SAApp, node SANodePath, dirPath string, fileName string) *SAJobCompile {
@@ -644,8 +1086,7 @@ func (jobs *SAJobs) AddCompile(app *SAApp, node SANodePath, dirPath string, file
 	defer jobs.lock.Unlock()
 
 	jb := NewSAJobCompile(app, node, dirPath, fileName, jobs)
-	jobs.compiles = append(jobs.compiles, jb)
-	go jb.Run()
+	jobs.add(jb, "compile", SAJob_interactive)
 	return jb
 }
 func (jobs *SAJobs) AddExe(app *SAApp, node SANodePath, dirPath string, programName string, input []byte) *SAJobExe {
@@ -654,8 +1095,19 @@ func (jobs *SAJobs) AddExe(app *SAApp, node SANodePath, dirPath string, programN
 
 	jobs.last_job_id++
 	jb := NewSAJobExe(strconv.Itoa(jobs.last_job_id), app, node, dirPath, programName, input, jobs)
-	jobs.exes = append(jobs.exes, jb)
-	go jb.Run()
+	jobs.add(jb, "cpu", SAJob_interactive)
+	return jb
+}
+
+// output is only returned, it's not applied to nodes
+func (jobs *SAJobs) AddExeIsolated(app *SAApp, node SANodePath, dirPath string, programName string, input []byte) *SAJobExe {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	jobs.last_job_id++
+	jb := NewSAJobExe(strconv.Itoa(jobs.last_job_id), app, node, dirPath, programName, input, jobs)
+	jb.only_result = true
+	jobs.add(jb, "cpu", SAJob_interactive)
 	return jb
 }
 func (jobs *SAJobs) AddWhisper(app *SAApp, node SANodePath, model string, blob OsBlob, props *SAServiceWhisperCppProps) *SAJobWhisperCpp {
@@ -663,26 +1115,57 @@ func (jobs *SAJobs) AddWhisper(app *SAApp, node SANodePath, model string, blob O
 	defer jobs.lock.Unlock()
 
 	jb := NewSAJobWhisperCpp(app, node, model, blob, props, jobs)
-	jobs.whispers = append(jobs.whispers, jb)
-	go jb.Run()
+	jobs.add(jb, "whisper", SAJob_interactive)
+	return jb
+}
+func (jobs *SAJobs) AddTTS(app *SAApp, node SANodePath, voice string, text string, props *SAServiceTTSProps) *SAJobTTS {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	jb := NewSAJobTTS(app, node, voice, text, props, jobs)
+	jobs.add(jb, "tts", SAJob_interactive)
 	return jb
 }
-func (jobs *SAJobs) AddLLama(app *SAApp, node SANodePath, props *SAServiceLLamaCppProps) *SAJobLLamaCpp {
+func (jobs *SAJobs) AddLLama(app *SAApp, node SANodePath, props *SAServiceLLamaCppProps, tools *SAServicesTools) *SAJobLLamaCpp {
 	jobs.lock.Lock()
 	defer jobs.lock.Unlock()
 
-	jb := NewSAJobLLamaCpp(app, node, props, jobs)
-	jobs.llamas = append(jobs.llamas, jb)
-	go jb.Run()
+	jb := NewSAJobLLamaCpp(app, node, props, tools, jobs)
+	if tools != nil {
+		tools.parent = jb
+	}
+	jobs.add(jb, "llm", SAJob_interactive)
 	return jb
 }
-func (jobs *SAJobs) AddOpenAI(app *SAApp, node SANodePath, props *SAServiceOpenAIProps) *SAJobOpenAI {
+func (jobs *SAJobs) AddOpenAI(app *SAApp, node SANodePath, props *SAServiceOpenAIProps, tools *SAServicesTools) *SAJobOpenAI {
 	jobs.lock.Lock()
 	defer jobs.lock.Unlock()
 
-	jb := NewSAJobOpenAI(app, node, props, jobs)
-	jobs.oais = append(jobs.oais, jb)
-	go jb.Run()
+	jb := NewSAJobOpenAI(app, node, props, tools, jobs)
+	if tools != nil {
+		tools.parent = jb
+	}
+	jobs.add(jb, "net", SAJob_interactive)
+	return jb
+}
+func (jobs *SAJobs) AddEmbeddings(jb *SAJobEmbeddings) *SAJobEmbeddings {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	priority := SAJob_interactive
+	if jb.op == "ingest" {
+		priority = SAJob_batch
+	}
+	jobs.add(jb, OsTrnString(jb.llama, "llm", "net"), priority)
+	return jb
+}
+
+func (jobs *SAJobs) AddHttp(app *SAApp, node SANodePath, props *SAServiceHttpProps, vars map[string]string) *SAJobHttp {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	jb := NewSAJobHttp(app, node, props, vars, jobs)
+	jobs.add(jb, "net", SAJob_interactive)
 	return jb
 }
 
@@ -691,47 +1174,74 @@ func (jobs *SAJobs) AddNet(app *SAApp, node SANodePath, path string, url string)
 	defer jobs.lock.Unlock()
 
 	jb := NewSAJobNet(app, node, path, url, jobs)
-	jobs.nets = append(jobs.nets, jb)
-	go jb.Run()
+	jobs.add(jb, "net", SAJob_batch)
 	return jb
 }
 
-func (jobs *SAJobs) getWhisper(init_model string) (*SAServiceWhisperCpp, error) {
+// process is started by first Transcribe()
+func (jobs *SAJobs) getWhisper(init_model string) *SAServiceWhisperCpp {
 	jobs.lock.Lock()
 	defer jobs.lock.Unlock()
 
-	var err error
 	if jobs.whisperCpp == nil {
-		jobs.whisperCpp, err = NewSAServiceWhisperCpp(jobs, "http://127.0.0.1", "8090", init_model)
+		jobs.whisperCpp = NewSAServiceWhisperCpp(jobs, init_model)
 	}
-	return jobs.whisperCpp, err
+	return jobs.whisperCpp
 }
 
-func (jobs *SAJobs) getLLama(init_model string) (*SAServiceLLamaCpp, error) {
+// process is started by first Speak()
+func (jobs *SAJobs) getTTS(init_voice string) *SAServiceTTS {
 	jobs.lock.Lock()
 	defer jobs.lock.Unlock()
 
-	var err error
-	if jobs.llamaCpp == nil {
-		jobs.llamaCpp, err = NewSAServiceLLamaCpp(jobs, "http://127.0.0.1", "8091", init_model)
+	if jobs.tts == nil {
+		jobs.tts = NewSAServiceTTS(jobs, init_voice)
 	}
-	return jobs.llamaCpp, err
+	return jobs.tts
+}
+
+// server with model loaded, call Release() after
+func (jobs *SAJobs) getLLama(model string, embedding bool, stop *atomic.Bool) (*SAServiceLLamaCpp, error) {
+	return jobs.llamaCpp.Get(model, embedding, stop)
 }
 
 func (jobs *SAJobs) getOpenAI() (*SAServiceOpenAI, error) {
 	jobs.lock.Lock()
 	defer jobs.lock.Unlock()
 
-	if !jobs.base.services.online {
-		return nil, fmt.Errorf("internet is disabled(Menu:Settings:Internet Connection)")
-	}
-
+	//online is checked per request, local servers work offline
 	if jobs.oai == nil {
 		jobs.oai = NewSAServiceOpenAI(jobs)
 	}
 	return jobs.oai, nil
 }
 
+func (jobs *SAJobs) getEmbeddings() *SAServiceEmbeddings {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	if jobs.embeddings == nil {
+		jobs.embeddings = NewSAServiceEmbeddings(jobs)
+	}
+	return jobs.embeddings
+}
+
+// returns nil if cache can't be opened, Get()/Put() with nil are ignored
+func (jobs *SAJobs) getCache() *SAServiceCache {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	if jobs.cache == nil {
+		var err error
+		jobs.cache, err = NewSAServiceCache(jobs)
+		if err != nil {
+			fmt.Printf("NewSAServiceCache() failed: %v\n", err)
+			return nil
+		}
+	}
+	return jobs.cache
+}
+
 /*func (jobs *SAJobs) GetNet() (*SAServiceNet, error) {
 	if !jobs.base.services.online {
 		return nil, fmt.Errorf("internet is disabled(Menu:Settings:Internet Connection)")
@@ -743,40 +1253,22 @@ func (jobs *SAJobs) getOpenAI() (*SAServiceOpenAI, error) {
 	return jobs.net, nil
 }*/
 
+// running job first
 func (jobs *SAJobs) FindAppProgress(app *SAApp) (string, float64) {
 	jobs.lock.Lock()
 	defer jobs.lock.Unlock()
 
-	for _, jb := range jobs.whispers {
-		if jb.app == app {
+	for _, jb := range jobs.list {
+		c := jb.common()
+		if c.app == app && c.started {
 			return jb.GetProgress()
 		}
 	}
-	for _, jb := range jobs.llamas {
-		if jb.app == app {
-			return jb.GetProgress()
-		}
-	}
-	for _, jb := range jobs.oais {
-		if jb.app == app {
-			return jb.GetProgress()
-		}
-	}
-	for _, jb := range jobs.nets {
-		if jb.app == app {
-			return jb.GetProgress()
-		}
-	}
-
-	for _, jb := range jobs.exes {
-		if jb.app == app {
-			return jb.GetProgress()
-		}
-	}
-
-	for _, jb := range jobs.compiles {
-		if jb.app == app {
-			return jb.GetProgress()
+	for _, jb := range jobs.list {
+		c := jb.common()
+		if c.app == app {
+			str, _ := jb.GetProgress()
+			return "Waiting: " + str, 0
 		}
 	}
 
@@ -793,46 +1285,21 @@ func (jobs *SAJobs) RenderAppProgress(app *SAApp) bool {
 	ui.Div_colMax(0, 20)
 
 	ok := false
-	for _, jb := range jobs.compiles {
-		if jb.app == app {
-			if jb.RenderProgress(&y) {
-				ok = true
-			}
-		}
-	}
-	for _, jb := range jobs.exes {
-		if jb.app == app {
-			if jb.RenderProgress(&y) {
-				ok = true
-			}
+	for _, jb := range jobs.list {
+		c := jb.common()
+		if c.app != app {
+			continue
 		}
-	}
-	for _, jb := range jobs.whispers {
-		if jb.app == app {
-			if jb.RenderProgress(&y) {
-				ok = true
-			}
-		}
-	}
-	for _, jb := range jobs.llamas {
-		if jb.app == app {
-			if jb.RenderProgress(&y) {
-				ok = true
-			}
+
+		if !c.started {
+			str, _ := jb.GetProgress()
+			ui.Comp_text(0, y, 1, 1, fmt.Sprintf("%s ... waiting for %s", str, c.resource), 0)
+			y++
+			ok = true
+			continue
 		}
-	}
-	for _, jb := range jobs.oais {
-		if jb.app == app {
-			if jb.RenderProgress(&y) {
-				ok = true
-			}
-		}
-	}
-	for _, jb := range jobs.nets {
-		if jb.app == app {
-			if jb.RenderProgress(&y) {
-				ok = true
-			}
+		if jb.RenderProgress(&y) {
+			ok = true
 		}
 	}
 	return ok
@@ -842,65 +1309,85 @@ func (jobs *SAJobs) FindJobExe(job_id string) *SAJobExe {
 	jobs.lock.Lock()
 	defer jobs.lock.Unlock()
 
-	for _, jb := range jobs.exes {
-		if jb.job_id == job_id {
-			return jb
+	for _, jb := range jobs.list {
+		if exe, ok := jb.(*SAJobExe); ok && exe.job_id == job_id {
+			return exe
 		}
 	}
 	return nil
 }
 
-func (jobs *SAJobs) Tick() {
-	jobs.lock.Lock()
-	defer jobs.lock.Unlock()
+// attribute 'answer' is updated while it's generated, so bound widgets(text, editbox) are updated in real time
+func (jobs *SAJobs) setNodeAnswer(app *SAApp, path SANodePath, answer string) {
+	node := path.Find(app.root)
+	if node == nil || !(node.IsTypeLLamacpp() || node.IsTypeOpenAI()) {
+		return //code assistant, etc.
+	}
 
-	for i := len(jobs.compiles) - 1; i >= 0; i-- {
-		jb := jobs.compiles[i]
-		if jb.done.Load() {
-			jobs.compile_stats.Add(jb.dt_time)
-			jb.PostRun()
-			jobs.compiles = append(jobs.compiles[:i], jobs.compiles[i+1:]...) //remove
-		}
+	if node.GetAttrString("answer", "") != answer {
+		node.Attrs["answer"] = answer
 	}
+}
 
-	for i := len(jobs.exes) - 1; i >= 0; i-- {
-		jb := jobs.exes[i]
-		if jb.done.Load() {
-			jobs.exe_stats.Add(jb.dt_time)
-			jb.PostRun()
-			jobs.exes = append(jobs.exes[:i], jobs.exes[i+1:]...) //remove
-		}
+func (jobs *SAJobs) setNodeUsage(app *SAApp, path SANodePath, usage *SAServiceUsage) {
+	node := path.Find(app.root)
+	if node == nil || !(node.IsTypeLLamacpp() || node.IsTypeOpenAI()) {
+		return //code assistant, etc.
 	}
+	u := *usage
+	node.last_usage = &u
+}
 
-	for i := len(jobs.whispers) - 1; i >= 0; i-- {
-		jb := jobs.whispers[i]
-		if jb.done.Load() {
-			jb.PostRun()
-			jobs.whispers = append(jobs.whispers[:i], jobs.whispers[i+1:]...) //remove
-		}
+func (jobs *SAJobs) Tick() {
+	//PostRun() can add new jobs(auto-fix), so it's called without lock
+	for _, jb := range jobs.tick() {
+		jb.PostRun()
 	}
+}
 
-	for i := len(jobs.llamas) - 1; i >= 0; i-- {
-		jb := jobs.llamas[i]
-		if jb.done.Load() {
-			jb.PostRun()
-			jobs.llamas = append(jobs.llamas[:i], jobs.llamas[i+1:]...) //remove
+// returns finished jobs
+func (jobs *SAJobs) tick() []SAJob {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	//stream answers
+	for _, jb := range jobs.list {
+		c := jb.common()
+		if !c.started || c.done.Load() {
+			continue
+		}
+		switch jb := jb.(type) {
+		case *SAJobLLamaCpp:
+			jobs.setNodeAnswer(jb.app, jb.node, jb.wip_answer.Get())
+			jobs.base.ui.win.SetRedraw() //keep updating
+		case *SAJobOpenAI:
+			jobs.setNodeAnswer(jb.app, jb.node, jb.wip_answer.Get())
+			jobs.base.ui.win.SetRedraw() //keep updating
 		}
 	}
 
-	for i := len(jobs.oais) - 1; i >= 0; i-- {
-		jb := jobs.oais[i]
-		if jb.done.Load() {
-			jb.PostRun()
-			jobs.oais = append(jobs.oais[:i], jobs.oais[i+1:]...) //remove
+	//finished
+	var finished []SAJob
+	n := 0
+	for _, jb := range jobs.list {
+		if !jb.common().done.Load() {
+			jobs.list[n] = jb
+			n++
+			continue
 		}
-	}
 
-	for i := len(jobs.nets) - 1; i >= 0; i-- {
-		jb := jobs.nets[i]
-		if jb.done.Load() {
-			jb.PostRun()
-			jobs.nets = append(jobs.nets[:i], jobs.nets[i+1:]...) //remove
+		switch jb := jb.(type) {
+		case *SAJobCompile:
+			jobs.compile_stats.Add(jb.dt_time)
+		case *SAJobExe:
+			jobs.exe_stats.Add(jb.dt_time)
 		}
+		finished = append(finished, jb)
+		jobs.addRecent(jb)
 	}
+	jobs.list = jobs.list[:n]
+
+	jobs.supervisor.Tick()
+
+	return finished
 }
@@ -0,0 +1,270 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func SAJobs_journalPath() string {
+	return "services/jobs.json"
+}
+
+// Unfinished job saved on disk, so it's restored after restart
+type SAJobJournalItem struct {
+	Type     string //"net", "llamacpp", "openai", "embeddings"
+	App      string
+	Node     string
+	Resource string
+	Priority int
+	Started  bool //was running when SkyAlt was closed
+	Params   json.RawMessage
+}
+
+type SAJobJournalNet struct {
+	Path string
+	Url  string
+}
+
+type SAJobJournalEmbeddings struct {
+	Op        string
+	Src_table string
+	Column    string
+}
+
+// jobs which can be restored override it
+func (c *SAJobCommon) journal() (string, interface{}) {
+	return "", nil
+}
+
+func (jb *SAJobNet) journal() (string, interface{}) {
+	return "net", SAJobJournalNet{Path: jb.path, Url: jb.url}
+}
+
+func (jb *SAJobLLamaCpp) journal() (string, interface{}) {
+	props := *jb.props
+	props.Messages = jb.messages
+	props.Tools = nil      //tools are not restored
+	props.Image_data = nil //images are too big, they are loaded from node again
+	return "llamacpp", props
+}
+
+func (jb *SAJobOpenAI) journal() (string, interface{}) {
+	props := *jb.props
+	props.Messages = jb.messages
+	props.Tools = nil
+	return "openai", props
+}
+
+func (jb *SAJobEmbeddings) journal() (string, interface{}) {
+	if jb.op != "ingest" {
+		return "", nil //search result is waited by code, which doesn't exist after restart
+	}
+	return "embeddings", SAJobJournalEmbeddings{Op: jb.op, Src_table: jb.src_table, Column: jb.column}
+}
+
+// rewrites journal with unfinished jobs. Call with lock, file is written in background.
+func (jobs *SAJobs) writeJournal() {
+	if jobs.closing {
+		return //running jobs are interrupted, keep them in journal
+	}
+
+	//skip writing when journaled jobs didn't change
+	var sig strings.Builder
+	for _, jb := range jobs.list {
+		c := jb.common()
+		if c.done.Load() {
+			continue
+		}
+		if tp, _ := jb.journal(); tp != "" {
+			fmt.Fprintf(&sig, "%d:%v,", c.seq, c.started)
+		}
+	}
+	if sig.String() == jobs.journal_sig {
+		return
+	}
+	jobs.journal_sig = sig.String()
+
+	items := []SAJobJournalItem{}
+	for _, jb := range jobs.list {
+		c := jb.common()
+		if c.done.Load() {
+			continue
+		}
+		tp, params := jb.journal()
+		if tp == "" {
+			continue
+		}
+		js, err := json.Marshal(params)
+		if err != nil {
+			fmt.Printf("Warning: journal Marshal() failed: %v\n", err)
+			continue
+		}
+		items = append(items, SAJobJournalItem{Type: tp, App: c.app.Name, Node: c.node.String(), Resource: c.resource, Priority: c.priority, Started: c.started, Params: js})
+	}
+
+	gen := jobs.journal_gen.Add(1)
+	jobs.journal_wg.Add(1)
+	go func() {
+		defer jobs.journal_wg.Done()
+
+		jobs.journal_lock.Lock()
+		defer jobs.journal_lock.Unlock()
+
+		if gen < jobs.journal_gen.Load() {
+			return //newer snapshot will be written
+		}
+		SAJobs_saveJournal(items)
+	}()
+}
+
+func SAJobs_saveJournal(items []SAJobJournalItem) {
+	js, err := json.MarshalIndent(items, "", "")
+	if err != nil {
+		fmt.Printf("MarshalIndent() failed: %v\n", err)
+		return
+	}
+
+	//write whole file first, so crash doesn't leave half of it
+	path := SAJobs_journalPath()
+	err = os.WriteFile(path+".temp", js, 0644)
+	if err != nil {
+		fmt.Printf("WriteFile() failed: %v\n", err)
+		return
+	}
+	err = os.Rename(path+".temp", path)
+	if err != nil {
+		fmt.Printf("Rename() failed: %v\n", err)
+	}
+}
+
+// adds jobs which were unfinished when SkyAlt was closed
+func (jobs *SAJobs) restoreJournal() {
+	js, err := os.ReadFile(SAJobs_journalPath())
+	if err != nil {
+		return //no journal
+	}
+	var items []SAJobJournalItem
+	err = json.Unmarshal(js, &items)
+	if err != nil {
+		fmt.Printf("Warning: journal Unmarshal() failed: %v\n", err)
+		return
+	}
+
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	for i := range items {
+		it := &items[i]
+		jb, err := jobs.restoreJob(it)
+		if err != nil {
+			fmt.Printf("Warning: job '%s' of '%s' can't be restored: %v\n", it.Type, it.App, err)
+			continue
+		}
+		jb.common().interrupted = OsTrnString(it.Started, "running", "queued")
+		jobs.add(jb, it.Resource, it.Priority)
+	}
+
+	jobs.writeJournal()
+}
+
+func (jobs *SAJobs) restoreJob(it *SAJobJournalItem) (SAJob, error) {
+	i := jobs.base.findApp(it.App)
+	if i < 0 {
+		return nil, fmt.Errorf("app not found")
+	}
+	app := jobs.base.Apps[i]
+	path := NewSANodePathFromString(it.Node)
+
+	if it.Type == "net" {
+		var p SAJobJournalNet
+		err := json.Unmarshal(it.Params, &p)
+		if err != nil {
+			return nil, fmt.Errorf("Unmarshal() failed: %w", err)
+		}
+		return NewSAJobNet(app, path, p.Path, p.Url, jobs), nil //continues from .temp file
+	}
+
+	//other jobs take settings from node
+	app.loadRoot()
+	node := path.Find(app.root)
+	if node == nil {
+		return nil, fmt.Errorf("node '%s' not found", it.Node)
+	}
+
+	switch it.Type {
+	case "llamacpp":
+		if !node.IsTypeLLamacpp() {
+			return nil, fmt.Errorf("node '%s' is not type 'llamacpp'", it.Node)
+		}
+		props, err := node.getLLamaProps(nil)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(it.Params, props) //saved values over node attributes
+		if err != nil {
+			return nil, fmt.Errorf("Unmarshal() failed: %w", err)
+		}
+		images, err := node.getLLamaImages(nil) //images from code call are not restored
+		if err != nil {
+			return nil, err
+		}
+		err = props.AddImages(images)
+		if err != nil {
+			return nil, err
+		}
+		return NewSAJobLLamaCpp(app, path, props, nil, jobs), nil
+
+	case "openai":
+		if !node.IsTypeOpenAI() {
+			return nil, fmt.Errorf("node '%s' is not type 'openai'", it.Node)
+		}
+		props, err := node.getOpenAIProps(nil)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(it.Params, props)
+		if err != nil {
+			return nil, fmt.Errorf("Unmarshal() failed: %w", err)
+		}
+		return NewSAJobOpenAI(app, path, props, nil, jobs), nil
+
+	case "embeddings":
+		if !node.IsTypeEmbeddings() {
+			return nil, fmt.Errorf("node '%s' is not type 'embeddings'", it.Node)
+		}
+		var p SAJobJournalEmbeddings
+		err := json.Unmarshal(it.Params, &p)
+		if err != nil {
+			return nil, fmt.Errorf("Unmarshal() failed: %w", err)
+		}
+		props, llama, db, table, err := node.getEmbeddingsProps()
+		if err != nil {
+			return nil, err
+		}
+		jb := NewSAJobEmbeddings(app, path, props, llama, db, table, jobs)
+		jb.op = p.Op
+		jb.src_table = p.Src_table
+		jb.column = p.Column
+		return jb, nil
+	}
+
+	return nil, fmt.Errorf("unknown type")
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+)
+
+// seconds in queue, running or total
+func (c *SAJobCommon) getElapsed() float64 {
+	if !c.started {
+		return OsTime() - c.add_time
+	}
+	if c.end_time > 0 {
+		if c.st_time > 0 {
+			return c.end_time - c.st_time
+		}
+		return c.end_time - c.add_time //canceled in queue
+	}
+	return OsTime() - c.st_time
+}
+
+func (c *SAJobCommon) getState() string {
+	switch {
+	case !c.started:
+		return "queued"
+	case !c.done.Load():
+		if c.waiting > 0 {
+			return "waiting"
+		}
+		return "running"
+	case c.canceled.Load():
+		return "canceled"
+	case c.outErr != nil:
+		return "error"
+	}
+	return "done"
+}
+
+// Global list of jobs across all apps, opened from Menu
+func (jobs *SAJobs) RenderPanel() {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	ui := jobs.base.ui
+
+	ui.Div_colMax(0, 30)
+	ui.Div_rowMax(0, 12)
+	ui.Div_rowMax(1, 8)
+
+	//list
+	ui.Div_start(0, 0, 1, 1)
+	{
+		ui.Div_colMax(0, 3)   //state
+		ui.Div_colMax(1, 4)   //app
+		ui.Div_colMax(2, 100) //description
+		ui.Div_colMax(3, 2)   //time
+		ui.Div_colMax(4, 3)   //cancel, retry
+		ui.Div_colMax(5, 2)   //detail
+
+		y := 0
+		section := func(title string, list []SAJob) {
+			if len(list) == 0 {
+				return
+			}
+			ui.Comp_text(0, y, 6, 1, fmt.Sprintf("%s(%d)", title, len(list)), 0)
+			y++
+			for _, jb := range list {
+				jobs.renderPanelRow(y, jb)
+				y++
+			}
+		}
+
+		var running, queued, recent []SAJob
+		for _, jb := range jobs.list {
+			if jb.common().started {
+				running = append(running, jb)
+			} else {
+				queued = append(queued, jb)
+			}
+		}
+		for i := len(jobs.recent) - 1; i >= 0; i-- {
+			recent = append(recent, jobs.recent[i]) //newest first
+		}
+
+		section("Running", running)
+		section("Queued", queued)
+		section("Recent", recent)
+
+		if y == 0 {
+			ui.Comp_text(0, 0, 6, 1, "No jobs", 1)
+		}
+
+		if len(running) > 0 || len(queued) > 0 {
+			ui.win.SetRedraw() //update times
+		}
+	}
+	ui.Div_end()
+
+	//detail
+	if jobs.selected != nil {
+		c := jobs.selected.common()
+		str, _ := jobs.selected.GetProgress()
+
+		text := fmt.Sprintf("%s\n%s(%s), %s, %.1fs", str, c.node.String(), c.resource, c.getState(), c.getElapsed())
+		if c.interrupted != "" {
+			text += fmt.Sprintf("\nInterrupted while %s, restored after restart", c.interrupted)
+		}
+		if c.outErr != nil {
+			text += "\n\nError:\n" + c.outErr.Error()
+		}
+		if log := jobs.selected.GetLog(); log != "" {
+			text += "\n\nOutput:\n" + log
+		}
+		ui.Comp_textSelectMulti(0, 1, 1, 1, text, 1.0, OsV2{0, 0}, true, true, false, true)
+	}
+}
+
+// call with lock
+func (jobs *SAJobs) renderPanelRow(y int, jb SAJob) {
+	ui := jobs.base.ui
+	c := jb.common()
+
+	state := c.getState()
+	str, proc := jb.GetProgress()
+	if state == "running" && proc >= 0 && proc <= 1 {
+		state = fmt.Sprintf("%.0f%%", proc*100)
+	}
+	if c.interrupted != "" {
+		str = "[interrupted] " + str //restored after restart
+	}
+
+	ui.Comp_text(0, y, 1, 1, state, 0)
+	ui.Comp_text(1, y, 1, 1, c.app.Name, 0)
+	ui.Comp_text(2, y, 1, 1, str, 0)
+	ui.Comp_text(3, y, 1, 1, fmt.Sprintf("%.1fs", c.getElapsed()), 2)
+
+	if c.done.Load() {
+		if SAJobs_canRetry(jb) && ui.Comp_buttonLight(4, y, 1, 1, "Retry", Comp_buttonProp()) > 0 {
+			jobs.selected = jobs.retry(jb)
+		}
+	} else {
+		if ui.Comp_buttonLight(4, y, 1, 1, "Cancel", Comp_buttonProp().SetError(true).Enable(!c.canceled.Load())) > 0 {
+			jobs.cancel(jb)
+			jobs.schedule()
+		}
+	}
+
+	if ui.Comp_buttonLight(5, y, 1, 1, "Detail", Comp_buttonProp().Enable(jobs.selected != jb)) > 0 {
+		jobs.selected = jb
+	}
+}
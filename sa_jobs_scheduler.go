@@ -0,0 +1,325 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+)
+
+// priorities, smaller is started first
+const (
+	SAJob_interactive = 0 //user or running code waits for result
+	SAJob_batch       = 1 //downloads, ingesting
+)
+
+const SAJobs_netLimit = 4 //parallel network jobs
+const SAJobs_maxRecent = 50
+
+type SAJob interface {
+	Run()
+	GetProgress() (string, float64)
+	RenderProgress(y *int) bool
+	PostRun()
+	Stop()
+	GetLog() string //captured output
+
+	common() *SAJobCommon
+	clone() SAJob                   //same parameters, for retry
+	journal() (string, interface{}) //type and parameters for restoring after restart. Empty type isn't saved
+}
+
+// Part of every job, used by scheduler
+type SAJobCommon struct {
+	app  *SAApp
+	node SANodePath
+
+	resource string //"compile", "cpu", "llm", "whisper", "tts", "net"
+	priority int
+	seq      int //FIFO
+
+	parent  *SAJobCommon //job which waits for this one
+	waiting int          //children which are not finished. Job doesn't occupy resource while waiting
+
+	started  bool
+	add_time float64
+	st_time  float64 //set when started
+	end_time float64
+
+	ctx        context.Context //canceled by Stop()
+	ctx_cancel context.CancelFunc
+	canceled   atomic.Bool
+
+	outErr error
+	done   atomic.Bool
+
+	interrupted string //"queued" or "running" when SkyAlt was closed, restored from journal
+}
+
+func (c *SAJobCommon) common() *SAJobCommon {
+	return c
+}
+
+// jobs with own stop flag override it
+func (c *SAJobCommon) Stop() {
+	c.ctx_cancel()
+}
+
+// job is using resource
+func (c *SAJobCommon) isRunning() bool {
+	return c.started && !c.done.Load() && c.waiting == 0
+}
+
+func (jobs *SAJobs) getLimit(resource string) int {
+	ini := &jobs.base.ui.win.io.ini
+
+	n := 1
+	switch resource {
+	case "compile", "cpu":
+		n = ini.Threads
+	case "llm":
+		n = ini.LLama_servers //local servers process one request at time
+	case "whisper", "tts":
+		n = 1 //one server process, doesn't wait for llm jobs
+	case "net":
+		n = SAJobs_netLimit
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// queues job and starts it if resource is free. Call with lock.
+func (jobs *SAJobs) add(jb SAJob, resource string, priority int) {
+	c := jb.common()
+	c.resource = resource
+	c.priority = priority
+	jobs.last_seq++
+	c.seq = jobs.last_seq
+	c.add_time = OsTime()
+	c.ctx, c.ctx_cancel = context.WithCancel(context.Background())
+
+	jobs.list = append(jobs.list, jb)
+	jobs.schedule()
+}
+
+// 'parent' waits for 'jb', so it releases its resource until 'jb' is finished. Without it, nested jobs(code -> llm -> tool -> code) can deadlock.
+func (jobs *SAJobs) SetParent(jb SAJob, parent SAJob) {
+	if parent == nil {
+		return
+	}
+
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	c := jb.common()
+	if c.done.Load() || c.parent != nil {
+		return
+	}
+	c.parent = parent.common()
+	c.parent.waiting++
+
+	jobs.schedule()
+}
+
+// number of parents which wait for jb
+func (jobs *SAJobs) GetDepth(jb SAJob) int {
+	if jb == nil {
+		return 0
+	}
+
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	depth := 0
+	for c := jb.common(); c != nil; c = c.parent {
+		depth++
+	}
+	return depth
+}
+
+// a is started before b
+func (jobs *SAJobs) isBefore(a, b *SAJobCommon) bool {
+	if a.priority != b.priority {
+		return a.priority < b.priority
+	}
+
+	//fairness: app which started job longest time ago is first
+	ta := jobs.app_turns[a.app]
+	tb := jobs.app_turns[b.app]
+	if ta != tb {
+		return ta < tb
+	}
+
+	return a.seq < b.seq
+}
+
+// starts queued jobs while resources are free. Call with lock.
+func (jobs *SAJobs) schedule() {
+	running := make(map[string]int)
+	for _, jb := range jobs.list {
+		c := jb.common()
+		if c.isRunning() {
+			running[c.resource]++
+		}
+	}
+
+	for {
+		var best SAJob
+		for _, jb := range jobs.list {
+			c := jb.common()
+			if c.started || running[c.resource] >= jobs.getLimit(c.resource) {
+				continue
+			}
+			if best == nil || jobs.isBefore(c, best.common()) {
+				best = jb
+			}
+		}
+		if best == nil {
+			jobs.writeJournal()
+			return
+		}
+
+		jobs.start(best)
+		running[best.common().resource]++
+	}
+}
+
+// call with lock
+func (jobs *SAJobs) start(jb SAJob) {
+	c := jb.common()
+	c.started = true
+	c.st_time = OsTime()
+
+	jobs.last_turn++
+	jobs.app_turns[c.app] = jobs.last_turn
+
+	go func() {
+		jb.Run()
+		jobs.finished(jb)
+	}()
+}
+
+func (jobs *SAJobs) finished(jb SAJob) {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	jobs.release(jb.common())
+	jobs.schedule()
+}
+
+// call with lock
+func (jobs *SAJobs) release(c *SAJobCommon) {
+	if c.parent != nil {
+		c.parent.waiting--
+		c.parent = nil
+	}
+	c.ctx_cancel()
+	c.end_time = OsTime()
+}
+
+// queued job is removed, running job is stopped. Jobs started by it are canceled too.
+func (jobs *SAJobs) Cancel(jb SAJob) {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	jobs.cancel(jb)
+	jobs.schedule()
+}
+
+// call with lock
+func (jobs *SAJobs) cancel(jb SAJob) {
+	c := jb.common()
+	if c.done.Load() {
+		return
+	}
+	c.canceled.Store(true)
+
+	//children first, so they don't wait for resource
+	for _, it := range jobs.list {
+		if it.common().parent == c {
+			jobs.cancel(it)
+		}
+	}
+
+	if !c.started {
+		c.started = true
+		c.outErr = errors.New("job was canceled")
+		c.done.Store(true) //PostRun() is called in Tick()
+		jobs.release(c)
+		return
+	}
+	jb.Stop()
+}
+
+// adds same job again
+func (jobs *SAJobs) Retry(jb SAJob) SAJob {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	return jobs.retry(jb)
+}
+
+// whisper, tts and search results are consumed by caller, which doesn't wait for new job
+func SAJobs_canRetry(jb SAJob) bool {
+	switch jb := jb.(type) {
+	case *SAJobCompile, *SAJobLLamaCpp, *SAJobOpenAI, *SAJobNet, *SAJobHttp:
+		return true
+	case *SAJobExe:
+		return !jb.only_result
+	case *SAJobEmbeddings:
+		return jb.op == "ingest"
+	}
+	return false
+}
+
+// returns nil when job can't be retried. Call with lock
+func (jobs *SAJobs) retry(jb SAJob) SAJob {
+	if !SAJobs_canRetry(jb) {
+		return nil
+	}
+	nj := jb.clone()
+
+	//code node waits for its job
+	switch nj := nj.(type) {
+	case *SAJobCompile:
+		if node := nj.node.Find(nj.app.root); node != nil {
+			node.Code.job_compile = nj
+		}
+	case *SAJobExe:
+		jobs.last_job_id++
+		nj.job_id = strconv.Itoa(jobs.last_job_id)
+		if node := nj.node.Find(nj.app.root); node != nil {
+			node.Code.job_exe = nj
+		}
+	}
+
+	c := jb.common()
+	jobs.add(nj, c.resource, c.priority)
+	return nj
+}
+
+// call with lock
+func (jobs *SAJobs) addRecent(jb SAJob) {
+	jobs.recent = append(jobs.recent, jb)
+	if len(jobs.recent) > SAJobs_maxRecent {
+		jobs.recent = jobs.recent[1:]
+	}
+}
@@ -51,6 +51,15 @@ func (base *SABase) drawMenu(ui *Ui) {
 	ui.Div_SpacerRow(0, y, 1, 1)
 	y++
 
+	//jobs
+	if ui.Comp_buttonMenuIcon(0, y, 1, 1, "Jobs", InitWinMedia_url("file:apps/base/resources/list.png"), iconMargin, false, Comp_buttonProp()) > 0 {
+		ui.Dialog_close()
+		ui.Dialog_open("jobs", 0)
+	}
+	y++
+	ui.Div_SpacerRow(0, y, 1, 1)
+	y++
+
 	//zoom
 	ui.Div_start(0, y, 1, 1)
 	{
@@ -260,8 +269,8 @@ func (base *SABase) drawMenuDialogs(ui *Ui) {
 		ui.Comp_editbox_desc(ui.trns.DPI, 0, 4, 1, y, 1, 2, &ini.Dpi, Comp_editboxProp().Precision(0))
 		y += 2
 
-		//ui.Comp_editbox_desc(ui.trns.THREADS, 0, 4, 1, y, 1, 2, &ini.Threads, Comp_editboxProp().Precision(0))
-		//y += 2
+		ui.Comp_editbox_desc(ui.trns.THREADS, 0, 4, 1, y, 1, 2, &ini.Threads, Comp_editboxProp().Precision(0))
+		y += 2
 
 		ui.Comp_switch(1, y, 2, 1, &ini.Stats, false, ui.trns.SHOW_STATS, "", true)
 		y++
@@ -297,6 +306,41 @@ func (base *SABase) drawMenuDialogs(ui *Ui) {
 			}
 			y++
 		}
+		if ui.Comp_buttonLight(1, y, 1, 1, "Secrets", Comp_buttonProp()) > 0 {
+			ui.Dialog_close()
+			ui.Dialog_open("secrets", 0)
+		}
+		y++
+
+		y++ //space
+
+		//AI cache
+		ui.Comp_editbox_desc("AI cache limit(MB)", 0, 4, 1, y, 1, 2, &ini.Cache_max_mb, Comp_editboxProp().Precision(0))
+		y++
+		ui.Comp_editbox_desc("AI cache expiration(days)", 0, 4, 1, y, 1, 2, &ini.Cache_ttl_days, Comp_editboxProp().Precision(0))
+		y++
+		if ui.Comp_buttonLight(1, y, 1, 1, "Browse AI cache", Comp_buttonProp()) > 0 {
+			ui.Dialog_close()
+			ui.Dialog_open("services_cache", 0)
+		}
+		y++
+
+		y++ //space
+
+		//llama.cpp
+		ui.Comp_editbox_desc("LLama.cpp loaded models", 0, 4, 1, y, 1, 2, &ini.LLama_servers, Comp_editboxProp().Precision(0))
+		y++
+		if loaded := base.jobs.llamaCpp.GetLoaded(); len(loaded) > 0 {
+			ui.Comp_text(1, y, 2, 1, "Loaded: "+strings.Join(loaded, ", "), 0)
+			y++
+		}
+		ui.Comp_editbox_desc("Unload idle AI servers after(min), -1 = never", 0, 4, 1, y, 1, 2, &ini.Services_idle_min, Comp_editboxProp().Precision(0))
+		y++
+		if ui.Comp_buttonLight(1, y, 1, 1, "AI servers", Comp_buttonProp()) > 0 {
+			ui.Dialog_close()
+			ui.Dialog_open("services_servers", 0)
+		}
+		y++
 
 		y++ //space
 
@@ -308,6 +352,53 @@ func (base *SABase) drawMenuDialogs(ui *Ui) {
 		ui.Dialog_end()
 	}
 
+	if ui.Dialog_start("services_cache") {
+		ui.Div_colMax(0, 30)
+		ui.Div_rowMax(0, 20)
+		ui.Div_start(0, 0, 1, 1)
+		{
+			cache := base.jobs.getCache()
+			if cache != nil {
+				cache.RenderBrowser()
+			}
+		}
+		ui.Div_end()
+		ui.Dialog_end()
+	}
+
+	if ui.Dialog_start("secrets") {
+		ui.Div_colMax(0, 30)
+		ui.Div_rowMax(0, 20)
+		ui.Div_start(0, 0, 1, 1)
+		{
+			base.secrets.RenderBrowser(ui)
+		}
+		ui.Div_end()
+		ui.Dialog_end()
+	}
+
+	if ui.Dialog_start("jobs") {
+		ui.Div_colMax(0, 30)
+		ui.Div_rowMax(0, 20)
+		ui.Div_start(0, 0, 1, 1)
+		{
+			base.jobs.RenderPanel()
+		}
+		ui.Div_end()
+		ui.Dialog_end()
+	}
+
+	if ui.Dialog_start("services_servers") {
+		ui.Div_colMax(0, 30)
+		ui.Div_rowMax(0, 20)
+		ui.Div_start(0, 0, 1, 1)
+		{
+			base.jobs.supervisor.RenderBrowser()
+		}
+		ui.Div_end()
+		ui.Dialog_end()
+	}
+
 }
 
 func (base *SABase) drawLauncher(app *SAApp, icon_rad float64) {
@@ -43,12 +43,14 @@ type SANode struct {
 	Exe      string
 	Selected bool `json:",omitempty"`
 
-	Code SANodeCode
+	Code   SANodeCode
+	Prompt *SANodePrompt `json:",omitempty"` //only for 'prompt' node
 
 	selected_cover  bool
 	selected_canvas OsV4
 
 	Attrs map[string]interface{} `json:",omitempty"` //only for Skyalt
+	Binds map[string]string      `json:",omitempty"` //attribute -> "{node.attr}" template
 
 	//sub-layout
 	Cols []*SANodeColRow `json:",omitempty"`
@@ -59,9 +61,16 @@ type SANode struct {
 
 	errExe error
 
+	last_usage    *SAServiceUsage //llamacpp, openai
+	http_response string          //http, last response of Send
+
+	webhook_wait *SAServiceWebhookRequest //webhook, request which waits for code nodes
+
 	z_depth float64
 
 	temp_mic_data audio.IntBuffer
+	mic_stream    *SAMicStream
+	audio         *SANodeAudio //audio_player
 
 	db_time DiskDbTime
 }
@@ -137,6 +146,19 @@ func (node *SANode) SetChange(exe_prms []SANodeCodeExePrm) {
 	}
 }
 
+// exe only code nodes which reads changed tables
+func (node *SANode) SetDbChange(tables []string, all bool) {
+	node = node.GetSubRootNode()
+
+	for _, nd := range node.app.exe.Subs {
+		if nd.IsTypeCode() && !nd.IsBypassed() && nd != node {
+			if nd.Code.findFuncDepend(node) != nil && (all || nd.Code.IsDbTableUsed(tables)) {
+				nd.Code.AddExe(nil)
+			}
+		}
+	}
+}
+
 func (node *SANode) SetStructChange() {
 
 	node.SetChange(nil) //exe depending
@@ -188,6 +210,9 @@ func (node *SANode) IsAttrDBValue() bool {
 	return false
 }
 
+func (node *SANode) IsTypeDiskFile() bool {
+	return node.Exe == "disk_file"
+}
 func (node *SANode) IsTypeWhispercpp() bool {
 	return node.Exe == "whispercpp"
 }
@@ -197,9 +222,27 @@ func (node *SANode) IsTypeLLamacpp() bool {
 func (node *SANode) IsTypeOpenAI() bool {
 	return node.Exe == "openai"
 }
+func (node *SANode) IsTypeTTS() bool {
+	return node.Exe == "tts"
+}
+func (node *SANode) IsTypeEmbeddings() bool {
+	return node.Exe == "embeddings"
+}
+func (node *SANode) IsTypePrompt() bool {
+	return node.Exe == "prompt"
+}
 func (node *SANode) IsTypeNet() bool {
 	return node.Exe == "net"
 }
+func (node *SANode) IsTypeHttp() bool {
+	return node.Exe == "http"
+}
+func (node *SANode) IsTypeWebhook() bool {
+	return node.Exe == "webhook"
+}
+func (node *SANode) IsTypeWatch() bool {
+	return node.Exe == "watch"
+}
 
 func (node *SANode) IsTypeButton() bool {
 	return strings.EqualFold(node.Exe, "button")
@@ -240,7 +283,7 @@ func (node *SANode) HasNodeSubs() bool {
 }
 
 func (node *SANode) HasAttrNode() bool {
-	return node.Exe == "whispercpp" || node.Exe == "llamacpp" || node.Exe == "openai" || node.Exe == "net"
+	return node.Exe == "whispercpp" || node.Exe == "llamacpp" || node.Exe == "openai" || node.Exe == "net" || node.Exe == "embeddings" || node.Exe == "tts" || node.Exe == "http"
 }
 
 func (node *SANode) IsBypassed() bool {
@@ -209,9 +209,9 @@ func (node *SANode) ShowAttrBool(grid *OsV4, name string, defValue bool) bool {
 
 	value := node.GetAttrBool(name, defValue)
 
-	node.showAttrName(grid, name, value == defValue)
+	editable := node.showAttrNameBind(grid, name, value == defValue)
 
-	if ui.Comp_switch(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &value, false, "", "", true) {
+	if ui.Comp_switch(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &value, false, "", "", editable) {
 		node.Attrs[name] = value
 		node.SetStructChange()
 	}
@@ -225,9 +225,9 @@ func (node *SANode) ShowAttrInt(grid *OsV4, name string, defValue int) int {
 
 	value := node.GetAttrInt(name, defValue)
 
-	node.showAttrName(grid, name, value == defValue)
+	editable := node.showAttrNameBind(grid, name, value == defValue)
 
-	_, _, _, fnshd1, _ := ui.Comp_editbox(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &value, Comp_editboxProp().Precision(0))
+	_, _, _, fnshd1, _ := ui.Comp_editbox(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &value, Comp_editboxProp().Precision(0).Enable(editable))
 	if fnshd1 {
 		node.Attrs[name] = value
 		node.SetStructChange()
@@ -241,9 +241,9 @@ func (node *SANode) ShowAttrFloat(grid *OsV4, name string, defValue float64, pre
 
 	value := node.GetAttrFloat(name, defValue)
 
-	node.showAttrName(grid, name, value == defValue)
+	editable := node.showAttrNameBind(grid, name, value == defValue)
 
-	_, _, _, fnshd1, _ := ui.Comp_editbox(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &value, Comp_editboxProp().Precision(prec))
+	_, _, _, fnshd1, _ := ui.Comp_editbox(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &value, Comp_editboxProp().Precision(prec).Enable(editable))
 	if fnshd1 {
 		node.Attrs[name] = value
 		node.SetStructChange()
@@ -263,11 +263,12 @@ func (node *SANode) ShowAttrStringEx(grid *OsV4, name string, defValue string, m
 
 	value := node.GetAttrString(name, defValue)
 
+	editable := node.GetBind(name) == ""
 	if showName {
-		node.showAttrName(grid, name, value == defValue)
+		editable = node.showAttrNameBind(grid, name, value == defValue)
 	}
 
-	_, _, _, fnshd, _ := ui.Comp_editbox(grid.Start.X+OsTrn(showName, 1, 0), grid.Start.Y, grid.Size.X, grid.Size.Y, &value, Comp_editboxProp().Align(0, OsTrn(multiLine, 0, 1)).MultiLine(multiLine, true).Formating(false))
+	_, _, _, fnshd, _ := ui.Comp_editbox(grid.Start.X+OsTrn(showName, 1, 0), grid.Start.Y, grid.Size.X, grid.Size.Y, &value, Comp_editboxProp().Align(0, OsTrn(multiLine, 0, 1)).MultiLine(multiLine, true).Formating(false).Enable(editable))
 	if fnshd {
 		node.Attrs[name] = value
 		node.SetStructChange()
@@ -287,10 +288,10 @@ func (node *SANode) ShowAttrIntCombo(grid *OsV4, name string, defValue int, opti
 
 	value := node.GetAttrInt(name, defValue)
 
-	node.showAttrName(grid, name, value == defValue)
+	editable := node.showAttrNameBind(grid, name, value == defValue)
 
 	valueStr := strconv.Itoa(value)
-	if ui.Comp_combo(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &valueStr, options_names, options_values, "", true, false) {
+	if ui.Comp_combo(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &valueStr, options_names, options_values, "", editable, false) {
 		node.Attrs[name], _ = strconv.Atoi(valueStr)
 		node.SetStructChange()
 	}
@@ -303,9 +304,9 @@ func (node *SANode) ShowAttrStringCombo(grid *OsV4, name string, defValue string
 
 	value := node.GetAttrString(name, defValue)
 
-	node.showAttrName(grid, name, value == defValue)
+	editable := node.showAttrNameBind(grid, name, value == defValue)
 
-	if ui.Comp_combo(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &value, options_names, options_values, "", true, false) {
+	if ui.Comp_combo(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &value, options_names, options_values, "", editable, false) {
 		node.Attrs[name] = value
 		node.SetStructChange()
 	}
@@ -319,9 +320,9 @@ func (node *SANode) ShowAttrFilePicker(grid *OsV4, name string, defValue string,
 
 	value := node.GetAttrString(name, defValue)
 
-	node.showAttrName(grid, name, value == defValue)
+	editable := node.showAttrNameBind(grid, name, value == defValue)
 
-	if ui.Comp_dirPicker(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &value, selectFile, errWhenEmpty, dialogName, true) {
+	if ui.Comp_dirPicker(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, &value, selectFile, errWhenEmpty, dialogName, editable) {
 		node.Attrs[name] = value
 		node.SetStructChange()
 	}
@@ -360,10 +361,12 @@ func (node *SANode) RenderAttrs() {
 		ui.Div_colMax(2, 4)
 
 		old_path := NewSANodePath(node)
+		old_name := node.Name
 		_, _, _, fnshd, _ := ui.Comp_editbox_desc("Name", 0, 3, 0, 0, 1, 1, &node.Name, Comp_editboxProp())
 		if fnshd {
 			node.CheckUniqueName()
 			node.GetRoot().RenameCodeSubDepends(old_path, NewSANodePath(node), node.IsTypeWithSubLayoutNodes())
+			node.GetRoot().RenameBinds(old_name, node.Name)
 		}
 
 		//type
@@ -0,0 +1,307 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var g_audio_sources = []string{"file", "db", "tts"}
+
+// Runtime state of audio_player node
+type SANodeAudio struct {
+	player *WinAudio
+	src    string //loaded source, player is re-created when it changes
+
+	job *SAJobTTS
+}
+
+func (au *SANodeAudio) Destroy() {
+	if au.player != nil {
+		au.player.Destroy()
+		au.player = nil
+	}
+	au.job = nil //result is ignored
+}
+
+func (node *SANode) getAudio() *SANodeAudio {
+	if node.audio == nil {
+		node.audio = &SANodeAudio{}
+		node.app.audio_nodes = append(node.app.audio_nodes, node)
+	}
+	return node.audio
+}
+
+func (node *SANode) getAudioSource() string {
+	switch node.GetAttrString("source", "file") {
+	case "db":
+		return "db:" + node.GetAttrString("db_blob", "")
+	case "tts":
+		text := node.GetAttrString("text", "")
+		if text == "" {
+			return ""
+		}
+		return "tts:" + node.GetAttrString("tts_node", "") + ":" + text
+	default:
+		path := node.GetAttrString("path", "")
+		if path == "" {
+			return ""
+		}
+		return "file:" + path
+	}
+}
+
+// file or db
+func (node *SANode) readAudio() ([]byte, error) {
+	if node.GetAttrString("source", "file") == "db" {
+		path, table, column, rowid, err := SANode_parseDBpath(node.GetAttrString("db_blob", ""))
+		if err != nil {
+			return nil, err
+		}
+		db, _, err := node.app.base.ui.win.disk.OpenDb(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var data []byte
+		db.Lock()
+		err = db.ReadRow_unsafe(fmt.Sprintf("SELECT %s FROM %s WHERE rowid=?", column, table), rowid).Scan(&data)
+		db.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("Scan() failed: %w", err)
+		}
+		return data, nil
+	}
+
+	data, err := os.ReadFile(node.GetAttrString("path", ""))
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile() failed: %w", err)
+	}
+	return data, nil
+}
+
+func (au *SANodeAudio) open(node *SANode, wavData []byte) {
+	var err error
+	au.player, err = NewWinAudioWav(wavData)
+	if err != nil {
+		node.SetError(err)
+		return
+	}
+	if node.GetAttrBool("autoplay", false) {
+		node.Attrs["playing"] = true
+	}
+}
+
+// called every tick, also when node is not visible
+func (au *SANodeAudio) Tick(node *SANode) {
+	//source changed
+	src := node.getAudioSource()
+	if src != au.src {
+		au.Destroy()
+		au.src = src
+
+		if strings.HasPrefix(src, "tts:") {
+			tts := node.GetRoot().FindNode(node.GetAttrString("tts_node", ""))
+			if tts == nil || !tts.IsTypeTTS() {
+				node.SetError(fmt.Errorf("tts node '%s' not found", node.GetAttrString("tts_node", "")))
+				return
+			}
+			voice, props, err := tts.getTTSProps()
+			if err != nil {
+				node.SetError(err)
+				return
+			}
+			au.job = node.app.base.jobs.AddTTS(node.app, NewSANodePath(node), voice, node.GetAttrString("text", ""), props)
+		} else if src != "" {
+			data, err := node.readAudio()
+			if err != nil {
+				node.SetError(err)
+				return
+			}
+			au.open(node, data)
+		}
+	}
+
+	//speech is ready
+	if au.job != nil && au.job.done.Load() {
+		if au.job.outErr != nil {
+			node.SetError(au.job.outErr)
+		} else {
+			au.open(node, au.job.output)
+		}
+		au.job = nil
+	}
+
+	if au.player == nil {
+		return
+	}
+
+	if au.player.CheckFinished() {
+		node.Attrs["playing"] = false
+		node.SetChange([]SANodeCodeExePrm{{Node: node.Name, Attr: "finished", Value: true}})
+	}
+
+	//attribute can be changed by code
+	playing := node.GetAttrBool("playing", false)
+	if playing != au.player.IsPlaying() {
+		if playing {
+			au.player.Play()
+		} else {
+			au.player.Pause()
+		}
+	}
+
+	if au.player.IsPlaying() {
+		node.app.base.ui.win.SetRedraw() //update position
+	}
+}
+
+// destroys players of removed nodes
+func (app *SAApp) tickAudio() {
+	for i := len(app.audio_nodes) - 1; i >= 0; i-- {
+		nd := app.audio_nodes[i]
+		if NewSANodePath(nd).Find(app.root) == nd {
+			nd.audio.Tick(nd)
+			continue
+		}
+
+		nd.audio.Destroy()
+		nd.audio = nil
+		app.audio_nodes = append(app.audio_nodes[:i], app.audio_nodes[i+1:]...) //remove
+	}
+}
+
+func (node *SANode) getTTSProps() (string, *SAServiceTTSProps, error) {
+	//attributes have same names as properties
+	js, err := json.Marshal(node.Attrs)
+	if err != nil {
+		return "", nil, fmt.Errorf("Marshal() failed: %w", err)
+	}
+	var props SAServiceTTSProps
+	err = json.Unmarshal(js, &props)
+	if err != nil {
+		return "", nil, fmt.Errorf("Unmarshal() failed: %w", err)
+	}
+	props.No_cache = !node.GetAttrBool("cache", true)
+
+	return node.GetAttrString("voice", ""), &props, nil
+}
+
+func UiTTS_listVoices() []string {
+	var voices []string
+	files, _ := os.ReadDir(g_tts_voicesFolder)
+	for _, f := range files {
+		if !f.IsDir() && filepath.Ext(f.Name()) == ".onnx" {
+			voices = append(voices, strings.TrimSuffix(f.Name(), ".onnx"))
+		}
+	}
+	return voices
+}
+
+func UiTTS_Attrs(node *SANode) {
+	ui := node.app.base.ui
+	ui.Div_colMax(0, 3)
+	ui.Div_colMax(1, 100)
+
+	grid := InitOsV4(0, 0, 1, 1)
+
+	voices := UiTTS_listVoices()
+	if len(voices) > 0 {
+		node.ShowAttrStringCombo(&grid, "voice", voices[0], voices, voices)
+	} else {
+		ui.Comp_text(1, grid.Start.Y, 1, 1, "Copy .onnx voices into "+g_tts_voicesFolder, 0)
+		grid.Start.Y++
+	}
+
+	node.ShowAttrInt(&grid, "speaker", 0)
+	node.ShowAttrFloat(&grid, "length_scale", 1, 3)
+	node.ShowAttrFloat(&grid, "noise_scale", 0.667, 3)
+	node.ShowAttrFloat(&grid, "noise_w", 0.8, 3)
+	node.ShowAttrFloat(&grid, "sentence_silence", 0.2, 3)
+	node.ShowAttrBool(&grid, "cache", true)
+}
+
+func UiAudioPlayer_Attrs(node *SANode) {
+	ui := node.app.base.ui
+	ui.Div_colMax(0, 3)
+	ui.Div_colMax(1, 100)
+
+	grid := InitOsV4(0, 0, 1, 1)
+	node.ShowAttrV4(&grid, "grid", InitOsV4(0, 0, 1, 1))
+	node.ShowAttrBool(&grid, "show", true)
+	node.ShowAttrBool(&grid, "enable", true)
+
+	switch node.ShowAttrStringCombo(&grid, "source", "file", g_audio_sources, g_audio_sources) {
+	case "db":
+		node.ShowAttrString(&grid, "db_blob", "", false) //"db_path:table:column:rowid"
+	case "tts":
+		node.ShowAttrString(&grid, "tts_node", "", false)
+		node.ShowAttrString(&grid, "text", "", true)
+	default:
+		node.ShowAttrFilePicker(&grid, "path", "", true, false, "audio_player_path_"+node.Name)
+	}
+
+	node.ShowAttrBool(&grid, "autoplay", false)
+	node.ShowAttrBool(&grid, "playing", false)
+}
+
+func UiAudioPlayer_render(node *SANode) {
+	grid := node.GetGrid()
+	enable := node.GetAttrBool("enable", true)
+
+	ui := node.app.base.ui
+	au := node.getAudio()
+
+	ui.Div_start(grid.Start.X, grid.Start.Y, grid.Size.X, grid.Size.Y)
+	{
+		ui.Div_colMax(0, 2)
+		ui.Div_colMax(1, 100)
+		ui.Div_colMax(2, 4)
+
+		if au.player == nil {
+			label := "No audio"
+			if au.job != nil {
+				label = "Generating speech ..."
+			}
+			ui.Comp_text(0, 0, 3, 1, label, 1)
+		} else {
+			playing := au.player.IsPlaying()
+			if ui.Comp_button(0, 0, 1, 1, OsTrnString(playing, "Pause", "Play"), Comp_buttonProp().Enable(enable)) > 0 {
+				node.Attrs["playing"] = !playing
+				au.Tick(node) //apply now
+				node.SetChange(nil)
+			}
+
+			pos := au.player.GetPos()
+			dur := au.player.GetDuration()
+			if ui.Comp_slider(1, 0, 1, 1, &pos, 0, dur, 0, enable) {
+				au.player.Seek(pos)
+			}
+			ui.Comp_text(2, 0, 1, 1, fmt.Sprintf("%s / %s", UiAudioPlayer_time(pos), UiAudioPlayer_time(dur)), 1)
+		}
+	}
+	ui.Div_end()
+}
+
+func UiAudioPlayer_time(sec float64) string {
+	s := int(sec)
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Binding is template: "Total: {sum.value}". When template is only one "{node.attr}", value is copied with its type.
+type SANodeBindRef struct {
+	node string
+	attr string
+
+	start, end int //position of "{...}" in template
+}
+
+func SANodeBind_parse(expr string) []SANodeBindRef {
+	var refs []SANodeBindRef
+
+	act := 0
+	for {
+		st := strings.IndexByte(expr[act:], '{')
+		if st < 0 {
+			break
+		}
+		st += act
+		en := strings.IndexByte(expr[st:], '}')
+		if en < 0 {
+			break
+		}
+		en += st + 1
+
+		node, attr, found := strings.Cut(expr[st+1:en-1], ".")
+		if found && node != "" && attr != "" {
+			refs = append(refs, SANodeBindRef{node: strings.TrimSpace(node), attr: strings.TrimSpace(attr), start: st, end: en})
+		}
+		act = en
+	}
+
+	return refs
+}
+
+func _SANodeBind_toString(value interface{}) string {
+	switch vv := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return OsTrnString(vv, "1", "0")
+	case int:
+		return strconv.Itoa(vv)
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	case string:
+		return vv
+	}
+	return fmt.Sprint(value)
+}
+
+func (node *SANode) GetBind(name string) string {
+	return node.Binds[name]
+}
+
+func (node *SANode) SetBind(name string, expr string) {
+	if expr == "" {
+		delete(node.Binds, name)
+		return
+	}
+
+	if node.Binds == nil {
+		node.Binds = make(map[string]string)
+	}
+	node.Binds[name] = expr
+}
+
+func (node *SANode) getBindSources() []*SANode {
+	var list []*SANode
+	root := node.GetRoot()
+	for _, expr := range node.Binds {
+		for _, ref := range SANodeBind_parse(expr) {
+			src := root.FindNode(ref.node)
+			if src != nil && src != node {
+				list = append(list, src)
+			}
+		}
+	}
+	return list
+}
+
+func (node *SANode) resolveBind(expr string) (interface{}, error) {
+	refs := SANodeBind_parse(expr)
+	root := node.GetRoot()
+
+	//direct
+	if len(refs) == 1 && refs[0].start == 0 && refs[0].end == len(expr) {
+		src := root.FindNode(refs[0].node)
+		if src == nil {
+			return nil, fmt.Errorf("bind node '%s' not found", refs[0].node)
+		}
+		return src.Attrs[refs[0].attr], nil
+	}
+
+	//template
+	str := ""
+	last := 0
+	for _, ref := range refs {
+		src := root.FindNode(ref.node)
+		if src == nil {
+			return nil, fmt.Errorf("bind node '%s' not found", ref.node)
+		}
+		str += expr[last:ref.start] + _SANodeBind_toString(src.Attrs[ref.attr])
+		last = ref.end
+	}
+	str += expr[last:]
+
+	return str, nil
+}
+
+func (node *SANode) resolveBinds() {
+	for name, expr := range node.Binds {
+		value, err := node.resolveBind(expr)
+		if err != nil {
+			node.SetError(err)
+			continue
+		}
+
+		if !reflect.DeepEqual(node.Attrs[name], value) {
+			node.Attrs[name] = value
+			node.SetChange(nil)
+		}
+	}
+}
+
+func (app *SAApp) ResolveBinds() {
+	for _, nd := range app.all_nodes {
+		if len(nd.Binds) > 0 {
+			nd.resolveBinds()
+		}
+	}
+}
+
+func (node *SANode) RenameBinds(oldName string, newName string) {
+	for name, expr := range node.Binds {
+		refs := SANodeBind_parse(expr)
+		for i := len(refs) - 1; i >= 0; i-- {
+			if refs[i].node == oldName {
+				expr = expr[:refs[i].start] + "{" + newName + "." + refs[i].attr + "}" + expr[refs[i].end:]
+			}
+		}
+		node.Binds[name] = expr
+	}
+
+	for _, it := range node.Subs {
+		it.RenameBinds(oldName, newName)
+	}
+}
+
+// returns false when attribute is bound, value is overwritten every frame so it's read-only
+func (node *SANode) showAttrNameBind(grid *OsV4, name string, isDefault bool) bool {
+	ui := node.app.base.ui
+
+	expr := node.GetBind(name)
+
+	label := name
+	if !isDefault {
+		label = "**" + label + "**"
+	}
+	if expr != "" {
+		label += " ←"
+	}
+
+	dnm := "bind_" + node.Name + "_" + name
+	if ui.Comp_buttonText(grid.Start.X+0, grid.Start.Y, grid.Size.X, grid.Size.Y, label, Comp_buttonProp().Align(0, 1).Tooltip(OsTrnString(expr != "", expr, "Bind to other attribute"))) > 0 {
+		ui.Dialog_open(dnm, 1)
+	}
+	if ui.Dialog_start(dnm) {
+		ui.Div_colMax(0, 10)
+
+		ui.Comp_text(0, 0, 1, 1, "Bind(\"{node.attr}\" or \"Total: {sum.value}\")", 0)
+
+		_, _, _, fnshd, _ := ui.Comp_editbox(0, 1, 1, 1, &expr, Comp_editboxProp().Ghost("{node.attr}").TempToValue(true))
+		if fnshd {
+			node.SetBind(name, expr)
+		}
+
+		if ui.Comp_button(0, 2, 1, 1, ui.trns.REMOVE, Comp_buttonProp().Enable(expr != "")) > 0 {
+			node.SetBind(name, "")
+			ui.Dialog_close()
+		}
+
+		ui.Dialog_end()
+	}
+
+	return node.GetBind(name) == ""
+}
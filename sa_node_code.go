@@ -33,12 +33,13 @@ import (
 //go:embed sa_node_const_go.goo
 var g_code_const_go string
 
-var g_str_imports = []string{"\"bytes\"", "\"encoding/json\"", "\"fmt\"", "\"io\"", "\"net/http\"", "\"os\"", "\"strconv\""}
+var g_str_imports = []string{"\"bytes\"", "\"encoding/json\"", "\"fmt\"", "\"io\"", "\"net/http\"", "\"os\"", "\"reflect\"", "\"strconv\"", "\"strings\"", "\"unicode/utf8\""}
 
 type SANodeCodeChat struct {
-	User      string
-	Assistent string
-	err       error
+	User        string
+	Assistent   string
+	Fix_attempt int `json:",omitempty"` //message was generated by auto-fix
+	err         error
 }
 type SANodeCodeImport struct {
 	Name string
@@ -84,10 +85,17 @@ type SANodeCode struct {
 
 	exes []SANodeCodeExe
 
-	job_exe *SAJobExe
+	job_exe     *SAJobExe
+	job_compile *SAJobCompile
 
-	job_oai       *SAJobOpenAI //answer is generated
-	job_oai_index int
+	fix SANodeCodeFix
+
+	//memoize
+	exe_hash  OsHash //inputs of last run
+	exe_outJs []byte //output of last successful run
+
+	job_chat       SAJobChat //answer is generated
+	job_chat_index int
 }
 
 func InitSANodeCode(node *SANode) SANodeCode {
@@ -528,6 +536,19 @@ type Microphone struct {
 	Enable  bool
 }`
 
+	case "Audio_player":
+		return `
+type Audio_player struct {
+	Source  string	//"file", "db", "tts"
+	Path    string	//WAV file
+	Db_blob string	//"db_path:table:column:rowid" with WAV blob
+	Tts_node string	//tts node, which speaks 'Text'
+	Text    string
+	Playing bool	//set true to play, false to pause
+	Finished bool	//true, when playing reached the end
+	Enable  bool
+}`
+
 	case "Map":
 		return `
 type MapLocator struct {
@@ -568,6 +589,52 @@ func (net *Net) DownloadFile(dst_file string, src_addr string) error {
 	return nil
 }`
 
+	case "Http":
+		return `
+type HttpResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    string
+}
+type Http struct {
+}
+//values replace {{name}} in url, query, headers and body. Status isn't checked, non-2xx response isn't error
+func (h *Http) Send(values map[string]string) (*HttpResponse, error) {
+	//TODO
+	return resp, nil
+}
+//unmarshal Body into 'out'
+func (r *HttpResponse) Json(out interface{}) error {
+	//TODO
+	return nil
+}`
+
+	case "Watch":
+		return `
+type Watch struct {
+	Path        string	//folder or glob
+	Debounce_ms int	//events are reported after nothing has changed for this time
+	Enable      bool
+	Created     []string	//paths of created files
+	Modified    []string	//paths of modified files
+	Deleted     []string	//paths of deleted files
+	Triggered   bool	//true, when folder has changed
+}`
+
+	case "Webhook":
+		return `
+type Webhook struct {
+	Method    string	//"GET", "POST", etc.
+	Headers   map[string]string
+	Query     map[string]string	//url parameters
+	Body      string
+	Triggered bool	//true, when request has come
+	Response        string	//returned to caller, when 'Respond' is on
+	Response_status int	//default 200
+	Respond   bool
+	Enable    bool
+}`
+
 	case "Whispercpp":
 		return `
 type Whispercpp struct {
@@ -580,6 +647,53 @@ func (w *Whispercpp) TranscribeBlob(data []byte) (string, error) {
 func (w *Whispercpp) TranscribeFile(filePath string) (string, error) {
 	//TODO
 	return text
+}
+type WhisperToken struct {
+	Text  string
+	P     float64	//probability
+	Start, End float64	//seconds
+}
+type WhisperSegment struct {
+	Start, End float64	//seconds
+	Text       string
+	Tokens     []WhisperToken
+	Confidence float64	//0-1
+	Speaker    string	//set when diarize or tinydiarize is on
+}
+func (w *Whispercpp) TranscribeBlobSegments(data []byte) ([]WhisperSegment, error) {
+	//TODO
+	return segments
+}
+func (w *Whispercpp) TranscribeFileSegments(filePath string) ([]WhisperSegment, error) {
+	//TODO
+	return segments
+}
+type WhisperSubtitleOpts struct {
+	Max_chars int	//longer segments are split, shorter neighbours are merged. 0 = keep segments
+	Max_gap   float64	//seconds, bigger gaps are never merged
+	Speakers  bool	//prefix text with speaker
+}
+func WhisperMergeSegments(segs []WhisperSegment, max_chars int, max_gap float64) []WhisperSegment
+func WhisperSplitSegments(segs []WhisperSegment, max_chars int) []WhisperSegment
+func WhisperSRT(segs []WhisperSegment, opts WhisperSubtitleOpts) string
+func WhisperVTT(segs []WhisperSegment, opts WhisperSubtitleOpts) string
+func WhisperJSON(segs []WhisperSegment, opts WhisperSubtitleOpts) (string, error)
+func (w *Whispercpp) WriteSRT(filePath string, segs []WhisperSegment, opts WhisperSubtitleOpts) error
+func (w *Whispercpp) WriteVTT(filePath string, segs []WhisperSegment, opts WhisperSubtitleOpts) error
+func (w *Whispercpp) WriteJSON(filePath string, segs []WhisperSegment, opts WhisperSubtitleOpts) error`
+
+	case "Tts":
+		return `
+type Tts struct {
+}
+//returns WAV
+func (t *Tts) Speak(text string) ([]byte, error) {
+	//TODO
+	return wav, nil
+}
+func (t *Tts) SpeakToFile(text string, filePath string) error {
+	//TODO
+	return nil
 }`
 
 	case "LlamaMessage":
@@ -594,6 +708,21 @@ type Llamacpp struct {
 func (ll *Llamacpp) GetAnswer(messages []LlamaMessage) (string, error) {
 	//TODO
 	return answer
+}
+//images(file paths, "file:path" or "db:path:table/column/rowid") are attached to last user message, model must have vision projector
+func (ll *Llamacpp) GetAnswerWithImages(messages []LlamaMessage, images []string) (string, error) {
+	//TODO
+	return answer
+}
+//callback is called for every new part of answer, return false to stop
+func (ll *Llamacpp) GetAnswerStream(messages []LlamaMessage, callback func(part string) bool) (string, error) {
+	//TODO
+	return answer
+}
+//answer is JSON(schema is built from 'out' struct) which is unmarshaled into 'out'
+func (ll *Llamacpp) GetStructuredAnswer(messages []LlamaMessage, out interface{}) error {
+	//TODO
+	return nil
 }`
 
 	case "Openai":
@@ -608,6 +737,31 @@ type Openai struct {
 func (oai *Openai) GetAnswer(messages []OpenaiMessage) (string, error) {
 	//TODO
 	return answer
+}
+//callback is called for every new part of answer, return false to stop
+func (oai *Openai) GetAnswerStream(messages []OpenaiMessage, callback func(part string) bool) (string, error) {
+	//TODO
+	return answer
+}`
+
+	case "Embeddings":
+		return `
+type EmbeddingsResult struct {
+	Table string
+	Rowid int64
+	Score float64	//cosine similarity, higher is closer
+}
+type Embeddings struct {
+}
+//computes vectors for new or changed rows of table.column, returns number of embedded rows
+func (e *Embeddings) Ingest(table string, column string) (int, error) {
+	//TODO
+	return n, nil
+}
+//returns k nearest rows
+func (e *Embeddings) Search(query string, k int) ([]EmbeddingsResult, error) {
+	//TODO
+	return results, nil
 }`
 	}
 
@@ -718,7 +872,7 @@ func (ls *SANodeCode) GetAnswer(index int) {
 
 	//build message array
 	messages := []SAServiceMsg{
-		{Role: "system", Content: "You are ChatGPT, an AI assistant. Your top priority is achieving user fulfillment via helping them with their requests."},
+		{Role: "system", Content: SAService_defaultSystemPrompt},
 	}
 
 	for i := 0; i < len(ls.Messages) && i <= index; i++ {
@@ -738,10 +892,35 @@ func (ls *SANodeCode) GetAnswer(index int) {
 		}
 	}
 
-	props := &SAServiceOpenAIProps{Model: ls.node.app.base.ui.win.io.ini.ChatModel, Messages: messages}
+	var err error
+	ls.job_chat, err = ls.node.app.GetChatBackend().AddJob(ls.node.app, NewSANodePath(ls.node), messages)
+	if err != nil {
+		ls.Messages[index].err = err
+		return
+	}
+	ls.job_chat_index = index
+}
+
+// saves finished answer. Called from UI and SAJobOpenAI.PostRun()
+func (ls *SANodeCode) finishAnswer() {
+	if ls.job_chat == nil || !ls.job_chat.IsDone() {
+		return
+	}
+
+	i := ls.job_chat_index
+	output, err := ls.job_chat.GetOutput()
+	ls.Messages[i].Assistent = string(output)
+	ls.job_chat = nil
+	ls.job_chat_index = -1
 
-	ls.job_oai = ls.node.app.base.jobs.AddOpenAI(ls.node.app, NewSANodePath(ls.node), props)
-	ls.job_oai_index = index
+	if err != nil {
+		ls.Messages[i].err = err
+		if ls.fix.active {
+			ls.fixDone(err)
+		}
+		return
+	}
+	ls.fixAnswered(i)
 }
 
 func (ls *SANodeCode) GetFileName() string {
@@ -820,21 +999,52 @@ func (ls *SANodeCode) Execute(exe_prms []SANodeCodeExePrm) {
 	//}
 
 	//input
-	vars := make(map[string]interface{})
-	for _, fn := range ls.func_depends {
-		vars[fn.node.Name] = fn.node.getAttributes(exe_prms)
-	}
-
-	inputJs, err := json.Marshal(vars)
+	inputJs, err := ls.buildExeInput(exe_prms)
 	if err != nil {
 		ls.exe_err = err
 		return
 	}
 
+	//memoize(events like 'triggered' always run)
+	hash, err := ls.getExeHash(inputJs)
+	if err == nil && len(exe_prms) == 0 && !ls.node.GetAttrBool("side_effects", false) {
+		if ls.exe_outJs != nil && hash.Cmp(&ls.exe_hash) {
+			ls.SetOutput(ls.exe_outJs) //same inputs => same output
+			return
+		}
+	}
+	ls.exe_hash = hash
+	ls.exe_outJs = nil
+
 	//run
 	ls.job_exe = ls.node.app.base.jobs.AddExe(ls.node.app, NewSANodePath(ls.node), "/temp/go/", ls.GetFileName(), inputJs)
 }
 
+func (ls *SANodeCode) buildExeInput(exe_prms []SANodeCodeExePrm) ([]byte, error) {
+	vars := make(map[string]interface{})
+	for _, fn := range ls.func_depends {
+		vars[fn.node.Name] = fn.node.getAttributes(exe_prms)
+	}
+	return json.Marshal(vars)
+}
+
+// hash of inputs, code and versions of databases
+func (ls *SANodeCode) getExeHash(inputJs []byte) (OsHash, error) {
+	src := append([]byte(nil), inputJs...)
+	src = append(src, ls.Code...)
+	for _, fn := range ls.func_depends {
+		if fn.node.IsTypeDbFile() {
+			src = append(src, fmt.Sprintf("%s:%d;", fn.node.Name, fn.node.db_time.version)...)
+		}
+	}
+	return InitOsHash(src)
+}
+
+func (ls *SANodeCode) ResetMemo() {
+	ls.exe_hash = OsHash{}
+	ls.exe_outJs = nil
+}
+
 func (ls *SANodeCode) setAttributes(node *SANode, attrs map[string]interface{}) {
 
 	if node.HasAttrNode() {
@@ -1050,6 +1260,7 @@ func (ls *SANodeCode) extractContent(code string) (string, error) {
 func (ls *SANodeCode) UpdateFile() {
 
 	ls.file_err = nil
+	ls.job_compile = nil
 
 	file, err := ls.buildCode()
 	if err != nil {
@@ -1079,7 +1290,7 @@ func (ls *SANodeCode) UpdateFile() {
 		if exeExist {
 			OsFileRemove(exePath)
 		}
-		ls.node.app.base.jobs.AddCompile(ls.node.app, NewSANodePath(ls.node), "temp/go/", fileName+".go")
+		ls.job_compile = ls.node.app.base.jobs.AddCompile(ls.node.app, NewSANodePath(ls.node), "temp/go/", fileName+".go")
 	}
 }
 
@@ -1350,6 +1561,35 @@ func (ls *SANodeCode) buildAllPromptsArgs() ([]*SANodeCodeFn, error) {
 	return depends, nil
 }
 
+// table names are searched in code(SQL is case-insensitive)
+func (ls *SANodeCode) IsDbTableUsed(tables []string) bool {
+	code := strings.ToLower(ls.Code)
+	for _, tb := range tables {
+		if HasWord(code, strings.ToLower(tb)) {
+			return true
+		}
+	}
+	return false
+}
+
+func HasWord(str string, word string) bool {
+	act := 0
+	for word != "" {
+		d := strings.Index(str[act:], word)
+		if d < 0 {
+			break
+		}
+		st := act + d
+		en := act + d + len(word)
+
+		if (st == 0 || !OsIsTextWord(rune(str[st-1]))) && (en >= len(str) || !OsIsTextWord(rune(str[en]))) {
+			return true
+		}
+		act = st + 1
+	}
+	return false
+}
+
 func ReplaceWord(str string, oldWord string, newWord string) string {
 	act := 0
 	for {
@@ -0,0 +1,128 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+)
+
+// openai_url = OpenAI compatible server
+var g_chat_backends = []string{"openai", "openai_url", "llamacpp"}
+
+// Backend for code assistant. Global one is in WinIni, app can override it.
+type SAChatBackend struct {
+	Backend string
+	Model   string
+	Url     string //openai_url
+	Headers string //openai_url, "Key: Value" per line
+	Node    string //llamacpp: sampling props are taken from this node, "" = defaults
+}
+
+// SAJobLLamaCpp, SAJobOpenAI
+type SAJobChat interface {
+	GetWipAnswer() string
+	GetOutput() ([]byte, error)
+	IsDone() bool
+	Stop()
+}
+
+func (app *SAApp) GetChatBackend() *SAChatBackend {
+	if app.Chat != nil {
+		return app.Chat
+	}
+	return &app.base.ui.win.io.ini.Chat
+}
+
+func (chat *SAChatBackend) AddJob(app *SAApp, node SANodePath, messages []SAServiceMsg) (SAJobChat, error) {
+	jobs := app.base.jobs
+
+	switch chat.Backend {
+	case "llamacpp":
+		var props *SAServiceLLamaCppProps
+		if chat.Node != "" {
+			nd := app.root.FindNode(chat.Node)
+			if nd == nil || !nd.IsTypeLLamacpp() {
+				return nil, fmt.Errorf("llamacpp node '%s' not found", chat.Node)
+			}
+			var err error
+			props, err = nd.getLLamaProps(messages)
+			if err != nil {
+				return nil, err
+			}
+			if chat.Model != "" {
+				props.Model = chat.Model
+			}
+		} else {
+			props = NewSAServiceLLamaCppProps(chat.Model, messages)
+			props.No_cache = true //regenerate gives new answer
+		}
+		return jobs.AddLLama(app, node, props, nil), nil
+
+	case "openai_url":
+		if chat.Url == "" {
+			return nil, fmt.Errorf("chat url is empty")
+		}
+		props := NewSAServiceOpenAIProps(chat.Model, messages)
+		props.Url = chat.Url
+		var err error
+		props.Headers, err = SAService_parseHeaders(chat.Headers)
+		if err != nil {
+			return nil, err
+		}
+		return jobs.AddOpenAI(app, node, props, nil), nil
+
+	default: //openai
+		props := NewSAServiceOpenAIProps(chat.Model, messages)
+		return jobs.AddOpenAI(app, node, props, nil), nil
+	}
+}
+
+func (chat *SAChatBackend) getModels(app *SAApp) []string {
+	switch chat.Backend {
+	case "llamacpp":
+		return app.base.jobs.llamaCpp.registry.GetNames()
+	case "openai":
+		return []string{"gpt-4-turbo", "gpt-3.5-turbo"} //https://platform.openai.com/docs/models/
+	}
+	return nil
+}
+
+// backend + model in one row
+func (chat *SAChatBackend) RenderRow(ui *Ui, app *SAApp, x int, y int) {
+	ui.Comp_combo(x, y, 1, 1, &chat.Backend, g_chat_backends, g_chat_backends, "Backend", true, false)
+
+	models := chat.getModels(app)
+	if models != nil {
+		ui.Comp_combo(x+1, y, 1, 1, &chat.Model, models, models, "Model", true, true)
+	} else {
+		ui.Comp_editbox(x+1, y, 1, 1, &chat.Model, Comp_editboxProp().Ghost("Model"))
+	}
+}
+
+// for context dialog
+func (chat *SAChatBackend) RenderSettings(ui *Ui, app *SAApp, y *int) {
+	switch chat.Backend {
+	case "openai_url":
+		ui.Comp_editbox(0, *y, 1, 1, &chat.Url, Comp_editboxProp().Ghost("Url, http://localhost:8000/v1/"))
+		(*y)++
+		ui.Comp_editbox(0, *y, 1, 2, &chat.Headers, Comp_editboxProp().Ghost("Headers, Key: {{secret:name}}").MultiLine(true, false))
+		*y += 2
+	case "llamacpp":
+		ui.Comp_editbox(0, *y, 1, 1, &chat.Node, Comp_editboxProp().Ghost("Sampling from llamacpp node(optional)"))
+		(*y)++
+	}
+}
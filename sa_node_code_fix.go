@@ -0,0 +1,187 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Auto-fix loop: code from answer is compiled(and tested), errors are sent back to chat model until it works or attempts run out.
+type SANodeCodeFix struct {
+	active  bool
+	attempt int
+	max     int
+
+	tests    [][]SANodeCodeExePrm
+	test_pos int       //-1 = not testing
+	job      *SAJobExe //running test
+
+	status string
+}
+
+// "test_inputs" attribute: [[{"Node": "a", "Attr": "value", "Value": 5}], ...], every item is one run. Empty = run once with current values.
+func (ls *SANodeCode) getTestInputs() ([][]SANodeCodeExePrm, error) {
+	var tests [][]SANodeCodeExePrm
+	str := strings.TrimSpace(ls.node.GetAttrString("test_inputs", ""))
+	if str != "" {
+		err := json.Unmarshal([]byte(str), &tests)
+		if err != nil {
+			return nil, fmt.Errorf("test_inputs: Unmarshal() failed: %w", err)
+		}
+	}
+	if len(tests) == 0 {
+		tests = append(tests, nil)
+	}
+	return tests, nil
+}
+
+func (ls *SANodeCode) StartAutoFix() {
+	if !ls.node.GetAttrBool("auto_fix", false) {
+		return
+	}
+
+	ls.fix = SANodeCodeFix{active: true, max: ls.node.GetAttrInt("auto_fix_attempts", 3), test_pos: -1}
+	ls.fixCheckBuild()
+}
+
+func (ls *SANodeCode) StopAutoFix() {
+	if ls.fix.job != nil {
+		ls.fix.job.Stop()
+	}
+	ls.fix = SANodeCodeFix{test_pos: -1}
+}
+
+func (ls *SANodeCode) fixCheckBuild() {
+	if ls.job_compile != nil {
+		ls.fix.status = "compiling"
+		return //fixCompiled() is called from SAJobCompile.PostRun()
+	}
+	ls.fixCompiled()
+}
+
+func (ls *SANodeCode) fixCompiled() {
+	if !ls.fix.active {
+		return
+	}
+
+	if ls.file_err != nil {
+		ls.fixSend("The code doesn't compile. Compiler output:", ls.file_err.Error())
+		return
+	}
+
+	if !ls.node.GetAttrBool("auto_fix_test", false) {
+		ls.fixDone(nil)
+		return
+	}
+
+	var err error
+	ls.fix.tests, err = ls.getTestInputs()
+	if err != nil {
+		ls.fixDone(err)
+		return
+	}
+	ls.fix.test_pos = 0
+	ls.fixRunTest()
+}
+
+func (ls *SANodeCode) fixRunTest() {
+	if ls.fix.test_pos >= len(ls.fix.tests) {
+		ls.fixDone(nil)
+		return
+	}
+
+	ls.fix.status = fmt.Sprintf("testing %d/%d", ls.fix.test_pos+1, len(ls.fix.tests))
+	if ls.node.IsBypassed() {
+		ls.fixExecuted(nil)
+		return
+	}
+
+	inputJs, err := ls.buildExeInput(ls.fix.tests[ls.fix.test_pos])
+	if err != nil {
+		ls.fixExecuted(err)
+		return
+	}
+
+	//test output is not applied to nodes, so other nodes don't change
+	ls.fix.job = ls.node.app.base.jobs.AddExeIsolated(ls.node.app, NewSANodePath(ls.node), "/temp/go/", ls.GetFileName(), inputJs)
+	//fixExecuted() is called from SAJobExe.PostRun()
+}
+
+func (ls *SANodeCode) fixExecuted(exe_err error) {
+	ls.fix.job = nil
+	if !ls.fix.active || ls.fix.test_pos < 0 {
+		return
+	}
+
+	if exe_err != nil {
+		problem := fmt.Sprintf("The code fails with test input %d. Output:", ls.fix.test_pos+1)
+		ls.fix.test_pos = -1
+		ls.fixSend(problem, exe_err.Error())
+		return
+	}
+
+	ls.fix.test_pos++
+	ls.fixRunTest()
+}
+
+// new chat message with error and failing code
+func (ls *SANodeCode) fixSend(problem string, output string) {
+	if ls.fix.attempt >= ls.fix.max {
+		ls.fixDone(fmt.Errorf("auto-fix failed after %d attempts", ls.fix.max))
+		return
+	}
+	ls.fix.attempt++
+
+	ls.CheckLastChatEmpty()
+	i := len(ls.Messages) - 1
+	ls.Messages[i].User = fmt.Sprintf("%s\n```\n%s\n```\n\nFailing code:\n```go\n%s\n```\nFix it and return the complete code.", problem, strings.TrimSpace(output), strings.TrimSpace(ls.Code))
+	ls.Messages[i].Fix_attempt = ls.fix.attempt
+
+	ls.fix.status = fmt.Sprintf("attempt %d/%d", ls.fix.attempt, ls.fix.max)
+	ls.GetAnswer(i)
+}
+
+// called when chat answer is finished
+func (ls *SANodeCode) fixAnswered(index int) {
+	if !ls.fix.active {
+		return
+	}
+
+	err := ls.UseCodeFromAnswer(ls.Messages[index].Assistent)
+	if err != nil {
+		ls.fixSend("Your answer doesn't contain code:", err.Error())
+		return
+	}
+	ls.fixCheckBuild()
+}
+
+func (ls *SANodeCode) fixDone(err error) {
+	if err != nil && len(ls.Messages) > 0 {
+		i := len(ls.Messages) - 1
+		if ls.Messages[i].Assistent == "" && i > 0 {
+			i-- //last answered
+		}
+		ls.Messages[i].err = err
+	}
+
+	ls.StopAutoFix()
+	if err == nil {
+		ls.fix.status = "code works"
+	}
+}
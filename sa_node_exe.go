@@ -231,8 +231,11 @@ func UiEditbox_Attrs(node *SANode) {
 }
 
 func (node *SANode) extractDBpath() (string, string, string, int, error) {
-	value := node.GetAttrString("value", "")
+	return SANode_parseDBpath(node.GetAttrString("value", ""))
+}
 
+// "db_path:table:column:rowid"
+func SANode_parseDBpath(value string) (string, string, string, int, error) {
 	parts := strings.Split(value, ":")
 	if len(parts) != 4 {
 		return "", "", "", 0, fmt.Errorf("invalid DB value format")
@@ -707,17 +710,27 @@ func UiMicrophone_Attrs(node *SANode) {
 	grid := InitOsV4(0, 0, 1, 1)
 	node.ShowAttrV4(&grid, "grid", InitOsV4(0, 0, 1, 1))
 	node.ShowAttrBool(&grid, "show", true)
-	node.ShowAttrFilePicker(&grid, "path", "", true, true, "microphone_path_"+node.Name)
+	node.ShowAttrFilePicker(&grid, "path", "", true, !node.GetAttrBool("streaming", false), "microphone_path_"+node.Name) //optional when streaming
 	node.ShowAttrBool(&grid, "enable", true)
+
+	//live transcription
+	if node.ShowAttrBool(&grid, "streaming", false) {
+		node.ShowAttrString(&grid, "whisper_node", "", false)
+		node.ShowAttrFloat(&grid, "vad_threshold", 0.02, 3)
+		node.ShowAttrInt(&grid, "vad_silence_ms", 600)
+		node.ShowAttrInt(&grid, "vad_min_ms", 300)
+		node.ShowAttrInt(&grid, "vad_max_ms", 15000)
+		node.ShowAttrFilePicker(&grid, "inject_wav", "", true, false, "microphone_inject_"+node.Name) //audio from file instead of device
+		node.ShowAttrString(&grid, "transcript", "", true)
+	}
 }
 
 func UiMicrophone_render(node *SANode) {
 	grid := node.GetGrid()
-	path := node.GetAttrString("path", "")
 	enable := node.GetAttrBool("enable", true)
 
 	nodePath := NewSANodePath(node)
-	rec_active := node.app.IsMicNodeRecording(nodePath)
+	rec_active := node.app.IsMicNodeRecording(nodePath) || node.app.IsMicStreamRecording(nodePath)
 
 	cd := CdPalette_B
 	if rec_active {
@@ -729,48 +742,76 @@ func UiMicrophone_render(node *SANode) {
 
 		if !rec_active {
 			//start
+			if node.GetAttrBool("streaming", false) {
+				st, err := NewSAMicStream(node)
+				if err != nil {
+					node.SetError(err)
+					return
+				}
+				st.pending = node.mic_stream //old recording can still wait for transcriptions
+				node.mic_stream = st
+				node.Attrs["transcript"] = ""
+				node.app.AddMicStream(nodePath)
+				if st.IsInjected() {
+					return //device is not used
+				}
+			}
+
 			if ui.win.io.ini.MicOff {
+				if node.mic_stream != nil {
+					node.mic_stream.Flush(node)
+				}
 				node.SetError(errors.New("microphone is disabled in SkyAlt Settings"))
 				return
 			}
 			node.app.AddMicNode(nodePath)
 		} else {
-			//stop
-			node.app.RemoveMicNode(nodePath)
+			UiMicrophone_stop(node)
+		}
+	}
+}
 
-			//make WAV file
-			{
-				//encode
-				//file := &OsWriterSeeker{}
-				file, err := os.Create(path)
-				if err != nil {
-					node.SetError(err)
-					return
-				}
+func UiMicrophone_stop(node *SANode) {
+	path := node.GetAttrString("path", "")
+	nodePath := NewSANodePath(node)
 
-				buff := node.temp_mic_data
-				enc := wav.NewEncoder(file, buff.Format.SampleRate, buff.SourceBitDepth, buff.Format.NumChannels, 1)
-				err = enc.Write(&buff)
-				if err != nil {
-					enc.Close()
-					file.Close()
-					node.SetError(err)
-					return
-				}
-				enc.Close()
-				file.Close()
+	device := node.app.RemoveMicNode(nodePath)
 
-				//save
-				//node.Attrs["data"] = file.buf.Bytes()
+	//transcribe rest, stream is removed after last transcription
+	if node.mic_stream != nil && node.mic_stream.recording {
+		node.mic_stream.Flush(node)
+	}
 
-				//reset
-				node.temp_mic_data.Data = nil
-			}
+	if device && (path != "" || !node.GetAttrBool("streaming", false)) {
+		//make WAV file
+		//file := &OsWriterSeeker{}
+		file, err := os.Create(path)
+		if err != nil {
+			node.SetError(err)
+			return
+		}
 
-			//set finished
-			node.SetChange([]SANodeCodeExePrm{{Node: node.Name, Attr: "triggered", Value: true}})
+		buff := node.temp_mic_data
+		enc := wav.NewEncoder(file, buff.Format.SampleRate, buff.SourceBitDepth, buff.Format.NumChannels, 1)
+		err = enc.Write(&buff)
+		if err != nil {
+			enc.Close()
+			file.Close()
+			node.SetError(err)
+			return
 		}
+		enc.Close()
+		file.Close()
+
+		//save
+		//node.Attrs["data"] = file.buf.Bytes()
 	}
+
+	//reset
+	node.temp_mic_data.Data = nil
+
+	//set finished
+	node.SetChange([]SANodeCodeExePrm{{Node: node.Name, Attr: "triggered", Value: true}})
 }
 
 func UiNet_Attrs(node *SANode) {
@@ -783,6 +824,222 @@ func UiNet_Attrs(node *SANode) {
 	node.ShowAttrString(&grid, "url", "", false)
 }
 
+func UiHttp_Attrs(node *SANode) {
+	ui := node.app.base.ui
+	ui.Div_colMax(0, 3)
+	ui.Div_colMax(1, 100)
+
+	grid := InitOsV4(0, 0, 1, 1)
+	node.ShowAttrStringCombo(&grid, "method", g_http_methods[0], g_http_methods, g_http_methods)
+	url := node.ShowAttrString(&grid, "url", "", false) //{{name}} is value from code, {{secret:name}} is value from Secrets
+	node.ShowAttrString(&grid, "query", "", true)       //"key: value" per line
+	node.ShowAttrString(&grid, "headers", "", true)     //"Key: Value" per line
+	bodyType := node.ShowAttrStringCombo(&grid, "body_type", g_http_bodyTypes[0], g_http_bodyTypes, g_http_bodyTypes)
+	if bodyType != "none" {
+		node.ShowAttrString(&grid, "body", "", true)
+	}
+
+	auth := node.ShowAttrStringCombo(&grid, "auth", g_http_auths[0], g_http_auths, g_http_auths)
+	if auth == "basic" {
+		node.ShowAttrString(&grid, "auth_user", "", false)
+	}
+	if auth != "none" {
+		names := node.app.base.secrets.GetNames()
+		def := ""
+		if len(names) > 0 {
+			def = names[0]
+		}
+		node.ShowAttrStringCombo(&grid, "auth_secret", def, names, names)
+	}
+	node.ShowAttrInt(&grid, "timeout_sec", 30)
+
+	//test request
+	node.ShowAttrString(&grid, "test_values", "", true) //"name: value" per line, used by Send
+	if ui.Comp_button(1, grid.Start.Y, 1, 1, "Send", Comp_buttonProp()) > 0 {
+		props := node.getHttpProps()
+		vars, err := SAServiceHttp_parseLines(node.GetAttrString("test_values", ""), nil)
+		if err == nil {
+			values := make(map[string]string)
+			for k := range vars {
+				values[k] = vars.Get(k)
+			}
+			node.app.base.jobs.AddHttp(node.app, NewSANodePath(node), props, values)
+		} else {
+			node.SetError(err)
+		}
+	}
+	grid.Start.Y++
+	if node.http_response != "" {
+		ui.Comp_textSelectMulti(0, grid.Start.Y, 2, 5, node.http_response, 1.0, OsV2{0, 0}, true, true, false, true)
+		grid.Start.Y += 5
+	}
+
+	if node.GetAttrString("url", "") == "" {
+		node.SetError(fmt.Errorf("url is empty"))
+	}
+	headers, err := SAService_parseHeaders(node.GetAttrString("headers", ""))
+	if err != nil {
+		node.SetError(err)
+	} else if err = SAService_checkHeaderSecrets(headers); err != nil {
+		node.SetError(err)
+	}
+	if auth != "none" {
+		_, err := node.app.base.secrets.Get(node.GetAttrString("auth_secret", ""))
+		if err != nil {
+			node.SetError(err)
+		}
+	}
+	if !node.app.base.services.online && !SAService_isLocalUrl(url) {
+		node.SetError(fmt.Errorf("internet is disabled(Menu:Settings:Internet Connection)"))
+	}
+}
+
+func (node *SANode) getHttpProps() *SAServiceHttpProps {
+	return &SAServiceHttpProps{
+		Method:      node.GetAttrString("method", g_http_methods[0]),
+		Url:         node.GetAttrString("url", ""),
+		Query:       node.GetAttrString("query", ""),
+		Headers:     node.GetAttrString("headers", ""),
+		Body_type:   node.GetAttrString("body_type", g_http_bodyTypes[0]),
+		Body:        node.GetAttrString("body", ""),
+		Auth:        node.GetAttrString("auth", g_http_auths[0]),
+		Auth_user:   node.GetAttrString("auth_user", ""),
+		Auth_secret: node.GetAttrString("auth_secret", ""),
+		Timeout_sec: node.GetAttrInt("timeout_sec", 30),
+	}
+}
+
+func UiWatch_Attrs(node *SANode) {
+	ui := node.app.base.ui
+	ui.Div_colMax(0, 3)
+	ui.Div_colMax(1, 100)
+
+	grid := InitOsV4(0, 0, 1, 1)
+	node.ShowAttrString(&grid, "path", "", false) //folder or glob("data/*.wav")
+	node.ShowAttrInt(&grid, "debounce_ms", 300)
+	node.ShowAttrBool(&grid, "enable", true)
+}
+
+func UiWebhook_Attrs(node *SANode) {
+	ui := node.app.base.ui
+	ui.Div_colMax(0, 3)
+	ui.Div_colMax(1, 100)
+
+	grid := InitOsV4(0, 0, 1, 1)
+	node.ShowAttrString(&grid, "path", node.Name, false)
+
+	ui.Comp_text(0, grid.Start.Y, 1, 1, "url", 0)
+	ui.Comp_textSelect(1, grid.Start.Y, 1, 1, node.app.base.services.GetWebhookUrl(node.getWebhookRoute()), OsV2{0, 1}, true, false, false)
+	grid.Start.Y++
+
+	//caller sends secret in 'X-Webhook-Secret' header, 'Authorization: Bearer' or '?secret='
+	names := node.app.base.secrets.GetNames()
+	if len(names) > 0 {
+		node.ShowAttrStringCombo(&grid, "secret", names[0], names, names)
+	} else {
+		ui.Comp_text(0, grid.Start.Y, 1, 1, "secret", 0)
+		ui.Comp_text(1, grid.Start.Y, 1, 1, "add a secret in Menu:Settings:Secrets", 0)
+		grid.Start.Y++
+	}
+	respond := node.ShowAttrBool(&grid, "respond", false) //wait for code nodes and return 'response'
+	if respond {
+		node.ShowAttrInt(&grid, "timeout_sec", 30)
+	}
+	node.ShowAttrBool(&grid, "enable", true)
+
+	_, err := node.app.base.secrets.Get(node.GetAttrString("secret", ""))
+	if err != nil {
+		node.SetError(err)
+	}
+	if !node.app.EnableExecution {
+		node.SetError(fmt.Errorf("execution is disabled, requests are rejected"))
+	}
+}
+
+func (node *SANode) getWebhookRoute() string {
+	return SAServiceWebhook_route(node.app, node.GetAttrString("path", node.Name))
+}
+
+// registers routes of webhook nodes. Only opened app processes requests.
+func (app *SAApp) tickWebhooks() {
+	active := app.base.Apps[app.base.Selected] == app && app.EnableExecution
+
+	hooks := make(map[string]*SAServiceWebhook)
+	for _, nd := range app.all_nodes {
+		if nd.IsTypeWebhook() && nd.GetAttrBool("enable", true) {
+			hooks[nd.getWebhookRoute()] = &SAServiceWebhook{
+				secret:      nd.GetAttrString("secret", ""),
+				respond:     nd.GetAttrBool("respond", false),
+				timeout_sec: nd.GetAttrInt("timeout_sec", 30),
+				active:      active,
+			}
+		}
+	}
+	app.base.services.SetWebhooks(app, hooks)
+}
+
+func (node *SANode) checkWebhook() {
+	if node.app.ExePos >= 0 {
+		if node.webhook_wait != nil {
+			node.app.base.ui.win.SetRedraw() //keep checking until code nodes finish
+		}
+		return
+	}
+
+	//code nodes have finished
+	if node.webhook_wait != nil {
+		node.webhook_wait.Respond(node.GetAttrInt("response_status", 200), node.GetAttrString("response", ""))
+		node.webhook_wait = nil
+	}
+
+	req := node.app.base.services.PopWebhook(node.getWebhookRoute())
+	if req == nil {
+		return
+	}
+
+	node.Attrs["method"] = req.Method
+	node.Attrs["headers"] = req.Headers
+	node.Attrs["query"] = req.Query
+	node.Attrs["body"] = req.Body
+	node.Attrs["response"] = "" //set by code nodes
+	node.Attrs["response_status"] = 200
+	node.SetChange([]SANodeCodeExePrm{{Node: node.Name, Attr: "triggered", Value: true}})
+
+	if req.resp != nil {
+		node.webhook_wait = req
+	}
+	node.app.base.ui.win.SetRedraw()
+}
+
+// active(reader -> path) collects watches which are used
+func (node *SANode) checkWatch(active map[string]string) {
+	path := node.GetAttrString("path", "")
+	if path == "" || !node.GetAttrBool("enable", true) {
+		return
+	}
+
+	w, err := node.app.base.ui.win.disk.OpenWatch(path)
+	if w == nil {
+		node.SetError(err)
+		return
+	}
+
+	reader := node.app.getWatchPrefix() + NewSANodePath(node).String()
+	active[reader] = path
+
+	ev, changed := w.Get(reader, node.GetAttrInt("debounce_ms", 300)) //registers reader also when watch failed, so it's not closed
+	if err != nil {
+		node.SetError(err)
+		return
+	}
+	if changed {
+		node.Attrs["created"] = ev.Created
+		node.Attrs["modified"] = ev.Modified
+		node.Attrs["deleted"] = ev.Deleted
+		node.SetChange([]SANodeCodeExePrm{{Node: node.Name, Attr: "triggered", Value: true}})
+	}
+}
+
 func UiLayout_Attrs(node *SANode) {
 	ui := node.app.base.ui
 	ui.Div_colMax(0, 3)
@@ -1427,23 +1684,41 @@ func UiCode_AttrChat(node *SANode) {
 	{
 		ui.Div_colMax(0, 100)
 
-		ui.Comp_text(0, 0, 1, 1, "Code chat", 1)
+		title := "Code chat"
+		if node.Code.fix.status != "" {
+			title += " - auto-fix: " + node.Code.fix.status
+		}
+		ui.Comp_text(0, 0, 1, 1, title, 1)
 
 		dnm := "chat_" + node.Name
 		if ui.Comp_buttonIcon(1, 0, 1, 1, InitWinMedia_url("file:apps/base/resources/context.png"), 0.3, "", Comp_buttonProp().Cd(CdPalette_B)) > 0 {
 			ui.Dialog_open(dnm, 1)
 		}
 		if ui.Dialog_start(dnm) {
-			ui.Div_colMax(0, 5)
+			ui.Div_colMax(0, 10)
 			y := 0
 
 			if ui.Comp_buttonMenu(0, y, 1, 1, "Clear all", false, Comp_buttonProp().Confirmation("Are you sure?", "clear_chat")) > 0 {
 				node.Code.Messages = nil
 				node.Code.CheckLastChatEmpty()
+				node.Code.StopAutoFix()
 				ui.Dialog_close()
 			}
 			y++
 
+			//chat backend
+			appChat := node.app.Chat != nil
+			if ui.Comp_checkbox(0, y, 1, 1, &appChat, false, "App's chat backend", "Otherwise global from Settings", true) {
+				if appChat {
+					chat := *node.app.GetChatBackend()
+					node.app.Chat = &chat
+				} else {
+					node.app.Chat = nil
+				}
+			}
+			y++
+			node.app.GetChatBackend().RenderSettings(ui, node.app, &y)
+
 			ui.Dialog_end()
 		}
 	}
@@ -1460,7 +1735,7 @@ func UiCode_AttrChat(node *SANode) {
 		y := 0
 		for i, msg := range node.Code.Messages {
 			isLast := (i+1 >= len(node.Code.Messages))
-			isAssistRunning := (node.Code.job_oai != nil && node.Code.job_oai_index == i)
+			isAssistRunning := (node.Code.job_chat != nil && node.Code.job_chat_index == i)
 
 			//user
 			{
@@ -1487,13 +1762,8 @@ func UiCode_AttrChat(node *SANode) {
 			if !isLast || isAssistRunning {
 				assist := msg.Assistent
 				if isAssistRunning {
-					assist = node.Code.job_oai.wip_answer
-					if node.Code.job_oai.done.Load() {
-						//save
-						node.Code.Messages[node.Code.job_oai_index].Assistent = string(node.Code.job_oai.output)
-						node.Code.job_oai = nil
-						node.Code.job_oai_index = -1
-					}
+					assist = node.Code.job_chat.GetWipAnswer()
+					node.Code.finishAnswer()
 				}
 
 				line_wrapping := false
@@ -1518,12 +1788,12 @@ func UiCode_AttrChat(node *SANode) {
 			msg := node.Code.Messages[i]
 			//for i, str := range node.Code.Messages {
 			isLast := (i+1 >= len(node.Code.Messages))
-			isAssistRunning := (node.Code.job_oai != nil && node.Code.job_oai_index == i)
+			isAssistRunning := (node.Code.job_chat != nil && node.Code.job_chat_index == i)
 
 			//user
 			{
 				line_wrapping := true
-				ui.Comp_textAlign(0, y, 1, 1, "User", 0, 0)
+				ui.Comp_textAlign(0, y, 1, 1, OsTrnString(msg.Fix_attempt > 0, fmt.Sprintf("Fix %d", msg.Fix_attempt), "User"), 0, 0)
 				/*_, _, _, fnshd, _ :=*/ ui.Comp_editbox(1, y, 1, 1, &node.Code.Messages[i].User, Comp_editboxProp().Align(0, 0).MultiLine(true, line_wrapping).TempToValue(true))
 				/*if fnshd {
 					//only to write error
@@ -1545,20 +1815,20 @@ func UiCode_AttrChat(node *SANode) {
 			{
 				ui.Div_colMax(0, 100)
 				ui.Div_colMax(1, 4)
-				ui.Div_colMax(2, 5)
-				//ui.Div_colMax(3, 1)
+				ui.Div_colMax(2, 4)
+				ui.Div_colMax(3, 5)
+				//ui.Div_colMax(4, 1)
 
-				//model
-				models := []string{"gpt-4-turbo", "gpt-3.5-turbo"} //https://platform.openai.com/docs/models/
-				ui.Comp_combo(1, 0, 1, 1, &node.app.base.ui.win.io.ini.ChatModel, models, models, "Model", true, true)
+				//backend, model
+				node.app.GetChatBackend().RenderRow(ui, node.app, 1, 0)
 
 				//send
-				if ui.Comp_buttonLight(2, 0, 1, 1, OsTrnString(isLast, "Send", "Re-send"), Comp_buttonProp().Enable(len(node.Code.Messages) > 0 && len(node.Code.Messages[0].User) > 0)) > 0 {
+				if ui.Comp_buttonLight(3, 0, 1, 1, OsTrnString(isLast, "Send", "Re-send"), Comp_buttonProp().Enable(len(node.Code.Messages) > 0 && len(node.Code.Messages[0].User) > 0)) > 0 {
 					node.Code.GetAnswer(i)
 				}
 
 				//delete
-				if ui.Comp_buttonLight(3, 0, 1, 1, "X", Comp_buttonProp().Confirmation("Are you sure?", "delete_chat_item_"+strconv.Itoa(i))) > 0 {
+				if ui.Comp_buttonLight(4, 0, 1, 1, "X", Comp_buttonProp().Confirmation("Are you sure?", "delete_chat_item_"+strconv.Itoa(i))) > 0 {
 					node.Code.Messages = append(node.Code.Messages[:i], node.Code.Messages[i+1:]...) //remove
 					node.Code.CheckLastChatEmpty()
 				}
@@ -1572,7 +1842,7 @@ func UiCode_AttrChat(node *SANode) {
 			if !isLast || isAssistRunning {
 				assist := msg.Assistent
 				if isAssistRunning {
-					assist = node.Code.job_oai.wip_answer
+					assist = node.Code.job_chat.GetWipAnswer()
 				}
 
 				{
@@ -1603,6 +1873,8 @@ func UiCode_AttrChat(node *SANode) {
 							err := node.Code.UseCodeFromAnswer(msg.Assistent)
 							if err != nil {
 								node.Code.Messages[i].err = err
+							} else {
+								node.Code.StartAutoFix()
 							}
 						}
 					}
@@ -1630,31 +1902,47 @@ func UiCode_Attrs(node *SANode) {
 func _UiCode_attrs(node *SANode, grid *OsV4) {
 	ui := node.app.base.ui
 
-	ui.Div_rowMax(1, 100)                   //code
-	ui.Div_rowResize(3, "output", 2, false) //output
+	//one row per attribute
+	attrs := []func(){
+		func() { node.ShowAttrBool(grid, "bypass", false) },
+		func() { node.ShowAttrBool(grid, "side_effects", false) }, //always run, even when inputs are same
+
+		//auto-fix code from chat
+		func() { node.ShowAttrBool(grid, "auto_fix", false) },
+		func() { node.ShowAttrInt(grid, "auto_fix_attempts", 3) },
+		func() { node.ShowAttrBool(grid, "auto_fix_test", false) },
+		func() { node.ShowAttrString(grid, "test_inputs", "", false) }, //[[{"Node": "a", "Attr": "value", "Value": 5}]]
+	}
+
+	//rows must be set before anything is drawn
+	y := grid.Start.Y + len(attrs)*grid.Size.Y //after attributes
+	ui.Div_rowMax(y, 100)                      //code
+	ui.Div_rowResize(y+2, "output", 2, false)  //output
 
-	//bypass
-	node.ShowAttrBool(grid, "bypass", false)
+	for _, fn := range attrs {
+		fn()
+	}
 
 	//Code
 	{
-		ui.Comp_textAlign(0, 1, 1, 1, "Code", 0, 0)
+		ui.Comp_textAlign(0, y, 1, 1, "Code", 0, 0)
 
-		_, _, _, fnshd, _ := ui.Comp_editbox(1, 1, 1, 1, &node.Code.Code, Comp_editboxProp().Align(0, 0).MultiLine(true, false).Formating(false).TempToValue(true))
+		_, _, _, fnshd, _ := ui.Comp_editbox(1, y, 1, 1, &node.Code.Code, Comp_editboxProp().Align(0, 0).MultiLine(true, false).Formating(false).TempToValue(true))
 		if fnshd {
 			node.Code.UpdateFile()
 		}
 
 		//run button
-		if ui.Comp_button(1, 2, 1, 1, "Run", Comp_buttonProp()) > 0 {
+		if ui.Comp_button(1, y+1, 1, 1, "Run", Comp_buttonProp()) > 0 {
+			node.Code.ResetMemo()
 			node.Code.Execute(nil)
 		}
 	}
 
 	//output
 	{
-		ui.Comp_textAlign(0, 3, 1, 1, "Output", 0, 0)
-		ui.Comp_textSelectMulti(1, 3, 1, 1, node.Code.cmd_output, 1.0, OsV2{0, 0}, true, true, false, false)
+		ui.Comp_textAlign(0, y+2, 1, 1, "Output", 0, 0)
+		ui.Comp_textSelectMulti(1, y+2, 1, 1, node.Code.cmd_output, 1.0, OsV2{0, 0}, true, true, false, false)
 	}
 }
 
@@ -1714,10 +2002,31 @@ func UiWhisperCpp_Attrs(node *SANode) {
 	node.ShowAttrFloat(&grid, "temperature_inc", 0.2, 3)
 
 	node.ShowAttrStringCombo(&grid, "response_format", "verbose_json", g_whisper_formats, g_whisper_formats)
+	node.ShowAttrBool(&grid, "cache", true)
+}
+
+func (node *SANode) getWhisperProps() (string, *SAServiceWhisperCppProps, error) {
+	//attributes have same names as properties
+	js, err := json.Marshal(node.Attrs)
+	if err != nil {
+		return "", nil, fmt.Errorf("Marshal() failed: %w", err)
+	}
+	var props SAServiceWhisperCppProps
+	err = json.Unmarshal(js, &props)
+	if err != nil {
+		return "", nil, fmt.Errorf("Unmarshal() failed: %w", err)
+	}
+	props.No_cache = !node.GetAttrBool("cache", true)
+
+	return node.GetAttrString("model", ""), &props, nil
 }
 
 var g_llama_modelsFolder = "services/llama.cpp/models/"
 
+func UiLLamaCpp_listModels(node *SANode) []string {
+	return node.app.base.jobs.llamaCpp.registry.GetNames()
+}
+
 func UiLLamaCpp_Attrs(node *SANode) {
 	ui := node.app.base.ui
 	ui.Div_colMax(0, 3)
@@ -1726,14 +2035,7 @@ func UiLLamaCpp_Attrs(node *SANode) {
 	grid := InitOsV4(0, 0, 1, 1)
 	ui.Div_start(0, 0, 2, 1)
 	{
-		//build model list
-		var models []string
-		modelFiles := OsFileListBuild(g_llama_modelsFolder, "", true)
-		for _, m := range modelFiles.Subs {
-			if !m.IsDir && !strings.HasPrefix(m.Name, "ggml-vocab") && !strings.HasSuffix(m.Name, ".temp") {
-				models = append(models, m.Name)
-			}
-		}
+		models := UiLLamaCpp_listModels(node)
 
 		ui.Div_colMax(0, 3)
 		ui.Div_colMax(1, 100)
@@ -1746,6 +2048,12 @@ func UiLLamaCpp_Attrs(node *SANode) {
 	}
 	ui.Div_end()
 
+	//model metadata
+	if m, found := node.app.base.jobs.llamaCpp.registry.Get(node.GetAttrString("model", "")); found {
+		ui.Comp_text(1, grid.Start.Y, 1, 1, m.GetInfo(), 0)
+		grid.Start.Y++
+	}
+
 	//...
 	/*stopAttr := node.GetAttr("stop", []byte(`["</s>", "Llama:", "User:"]`))
 	err := json.Unmarshal(stopAttr.GetBlob().data, &props.Stop)
@@ -1753,7 +2061,7 @@ func UiLLamaCpp_Attrs(node *SANode) {
 		stopAttr.SetError(err)
 	}*/
 
-	node.ShowAttrInt(&grid, "seed", -1)
+	node.ShowAttrInt(&grid, "seed", -1) //-1 = random
 	node.ShowAttrInt(&grid, "n_predict", 400)
 
 	node.ShowAttrFloat(&grid, "temperature", 0.8, 3)
@@ -1772,11 +2080,98 @@ func UiLLamaCpp_Attrs(node *SANode) {
 	node.ShowAttrBool(&grid, "mirostat", false)
 	node.ShowAttrFloat(&grid, "mirostat_tau", 5, 3)
 	node.ShowAttrFloat(&grid, "mirostat_eta", 0.1, 3)
-	//Grammar
+	node.ShowAttrString(&grid, "grammar", "", true)     //GBNF
+	node.ShowAttrString(&grid, "json_schema", "", true) //overrides grammar
 	node.ShowAttrInt(&grid, "n_probs", 0)
-	//Image_data
+	node.ShowAttrString(&grid, "images", "", true) //per line: disk_file node, file path, "file:path" or "db:path:table/column/rowid"
 	node.ShowAttrBool(&grid, "cache_prompt", false)
 	node.ShowAttrInt(&grid, "slot_id", -1)
+	node.ShowAttrBool(&grid, "cache", true) //random seed(-1) is never cached
+
+	node.ShowAttrString(&grid, "tool_nodes", "", false) //"db, transcribe"
+	node.showAttrPrompt(&grid)
+	node.showAttrContext(&grid)
+	err := node.checkToolNodes()
+	if err != nil {
+		node.SetError(err)
+	}
+}
+
+func (node *SANode) getLLamaProps(messages []SAServiceMsg) (*SAServiceLLamaCppProps, error) {
+	props := NewSAServiceLLamaCppProps(node.GetAttrString("model", ""), messages)
+
+	//attributes have same names as properties
+	js, err := json.Marshal(node.Attrs)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(js, props)
+	if err != nil {
+		return nil, err
+	}
+	props.Messages = messages
+
+	props.No_cache = !node.GetAttrBool("cache", true) || props.Seed == -1
+	props.Context_budget = node.GetAttrInt("context_budget", 0)
+	props.Context_strategy = node.GetAttrString("context_strategy", g_context_strategies[0])
+
+	return props, nil
+}
+
+// image sources: disk_file node name, WinMedia url("file:", "db:") or file path
+func (node *SANode) getLLamaImages(sources []string) ([][]byte, error) {
+	for _, line := range strings.Split(node.GetAttrString("images", ""), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			sources = append(sources, line)
+		}
+	}
+
+	var images [][]byte
+	for _, src := range sources {
+		var data []byte
+		var err error
+		if strings.HasPrefix(src, "file:") || strings.HasPrefix(src, "db:") {
+			media := InitWinMedia_url(src)
+			data, err = media.GetBlob(node.app.base.ui.win.disk)
+		} else if nd := node.GetRoot().FindNode(src); nd != nil && nd.IsTypeDiskFile() {
+			data, err = os.ReadFile(nd.GetAttrString("path", ""))
+		} else {
+			data, err = os.ReadFile(src)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("image '%s': %w", src, err)
+		}
+		images = append(images, data)
+	}
+	return images, nil
+}
+
+// context window + usage of last run
+func (node *SANode) showAttrContext(grid *OsV4) {
+	ui := node.app.base.ui
+
+	node.ShowAttrInt(grid, "context_budget", 0) //0 = model context length
+	node.ShowAttrStringCombo(grid, "context_strategy", g_context_strategies[0], g_context_strategies, g_context_strategies)
+
+	if node.last_usage != nil {
+		ui.Comp_text(grid.Start.X, grid.Start.Y, 1, 1, "usage", 0)
+		ui.Comp_text(grid.Start.X+1, grid.Start.Y, grid.Size.X, grid.Size.Y, node.last_usage.String(), 0)
+		grid.Start.Y += grid.Size.Y
+	}
+}
+
+func (node *SANode) checkToolNodes() error {
+	for _, nm := range SAServicesTools_parseList(node.GetAttrString("tool_nodes", "")) {
+		nd := node.GetRoot().FindNode(nm)
+		if nd == nil {
+			return fmt.Errorf("tool node '%s' not found", nm)
+		}
+		if !SAServicesTools_isSupported(nd) {
+			return fmt.Errorf("node '%s' can't be tool(only db_file, net, whispercpp, code)", nm)
+		}
+	}
+	return nil
 }
 
 var g_oia_modelList = []string{"gpt-3.5-turbo", "gpt-4", "gpt-4-turbo-preview"}
@@ -1787,12 +2182,157 @@ func UiOpenAI_Attrs(node *SANode) {
 	ui.Div_colMax(1, 100)
 
 	grid := InitOsV4(0, 0, 1, 1)
-	node.ShowAttrStringCombo(&grid, "model", g_oia_modelList[0], g_oia_modelList, g_oia_modelList)
-	//more ...............
+	url := node.ShowAttrString(&grid, "url", SAServiceOpenAI_defaultUrl, false)
+	isDefaultUrl := SAServiceOpenAI_isDefaultUrl(url)
+	if isDefaultUrl {
+		node.ShowAttrStringCombo(&grid, "model", g_oia_modelList[0], g_oia_modelList, g_oia_modelList)
+	} else {
+		node.ShowAttrString(&grid, "model", g_oia_modelList[0], false) //server's model name
+	}
+	node.ShowAttrString(&grid, "headers", "", true)
+
+	node.ShowAttrFloat(&grid, "temperature", 1, 3)
+	node.ShowAttrFloat(&grid, "top_p", 1, 3)
+	node.ShowAttrInt(&grid, "max_tokens", 0)
+	node.ShowAttrFloat(&grid, "presence_penalty", 0, 3)
+	node.ShowAttrFloat(&grid, "frequency_penalty", 0, 3)
+	node.ShowAttrInt(&grid, "seed", -1) //-1 = random
+	node.ShowAttrString(&grid, "stop", "", false)
+	node.ShowAttrBool(&grid, "cache", true)             //random seed(-1) is never cached
+	node.ShowAttrString(&grid, "tool_nodes", "", false) //"db, transcribe"
+	node.showAttrPrompt(&grid)
+	node.showAttrContext(&grid)
+
+	props, err := node.getOpenAIProps(nil)
+	if err != nil {
+		node.SetError(err)
+	} else if err = SAService_checkHeaderSecrets(props.Headers); err != nil {
+		node.SetError(err)
+	}
+	err = node.checkToolNodes()
+	if err != nil {
+		node.SetError(err)
+	}
 
-	if node.app.base.ui.win.io.ini.OpenAI_key == "" {
+	if isDefaultUrl && node.app.base.ui.win.io.ini.OpenAI_key == "" {
 		node.SetError(fmt.Errorf("openAI API key is not set. Fill it in Menu:Settings"))
 	}
+	if !node.app.base.services.online && !SAService_isLocalUrl(url) {
+		node.SetError(fmt.Errorf("internet is disabled(Menu:Settings:Internet Connection)"))
+	}
+}
+
+func (node *SANode) getOpenAIProps(messages []SAServiceMsg) (*SAServiceOpenAIProps, error) {
+	props := NewSAServiceOpenAIProps(node.GetAttrString("model", g_oia_modelList[0]), messages)
+
+	props.Url = node.GetAttrString("url", SAServiceOpenAI_defaultUrl)
+	var err error
+	props.Headers, err = SAService_parseHeaders(node.GetAttrString("headers", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	props.Temperature = node.GetAttrFloat("temperature", 1)
+	props.Top_p = node.GetAttrFloat("top_p", 1)
+	props.Max_tokens = node.GetAttrInt("max_tokens", 0)
+	props.Presence_penalty = node.GetAttrFloat("presence_penalty", 0)
+	props.Frequency_penalty = node.GetAttrFloat("frequency_penalty", 0)
+
+	seed := node.GetAttrInt("seed", -1)
+	if seed >= 0 {
+		props.Seed = &seed
+	}
+
+	//stop is JSON array: ["\n", "User:"]
+	stop := node.GetAttrString("stop", "")
+	if stop != "" {
+		err = json.Unmarshal([]byte(stop), &props.Stop)
+		if err != nil {
+			return nil, fmt.Errorf("attribute 'stop' must be JSON array of strings: %w", err)
+		}
+	}
+
+	props.No_cache = !node.GetAttrBool("cache", true) || seed < 0
+	props.Context_budget = node.GetAttrInt("context_budget", 0)
+	props.Context_strategy = node.GetAttrString("context_strategy", g_context_strategies[0])
+
+	return props, nil
+}
+
+var g_embeddings_backends = []string{"llamacpp", "openai"}
+
+func UiEmbeddings_Attrs(node *SANode) {
+	ui := node.app.base.ui
+	ui.Div_colMax(0, 3)
+	ui.Div_colMax(1, 100)
+
+	grid := InitOsV4(0, 0, 1, 1)
+	backend := node.ShowAttrStringCombo(&grid, "backend", g_embeddings_backends[0], g_embeddings_backends, g_embeddings_backends)
+	if backend == "openai" {
+		node.ShowAttrString(&grid, "url", SAServiceOpenAI_defaultUrl, false)
+		node.ShowAttrString(&grid, "model", "text-embedding-3-small", false)
+		node.ShowAttrString(&grid, "headers", "", true)
+	} else {
+		models := UiLLamaCpp_listModels(node)
+		defModel := ""
+		if len(models) > 0 {
+			defModel = models[0]
+		}
+		node.ShowAttrStringCombo(&grid, "model", defModel, models, models)
+	}
+
+	//list of db_file nodes
+	var dbs []string
+	for _, nd := range node.app.all_nodes {
+		if nd.IsTypeDbFile() {
+			dbs = append(dbs, nd.Name)
+		}
+	}
+	defDb := ""
+	if len(dbs) > 0 {
+		defDb = dbs[0]
+	}
+	node.ShowAttrStringCombo(&grid, "db", defDb, dbs, dbs)
+	node.ShowAttrString(&grid, "table", "embeddings", false)
+
+	props, _, _, _, err := node.getEmbeddingsProps()
+	if err != nil {
+		node.SetError(err)
+	} else if err = SAService_checkHeaderSecrets(props.Headers); err != nil {
+		node.SetError(err)
+	}
+}
+
+// returns properties, true if llama.cpp server is used, database and table for vectors
+func (node *SANode) getEmbeddingsProps() (*SAServiceEmbeddingsProps, bool, *DiskDb, string, error) {
+	props := &SAServiceEmbeddingsProps{Model: node.GetAttrString("model", "")}
+
+	llama := node.GetAttrString("backend", g_embeddings_backends[0]) != "openai"
+	if !llama {
+		props.Url = node.GetAttrString("url", SAServiceOpenAI_defaultUrl)
+		var err error
+		props.Headers, err = SAService_parseHeaders(node.GetAttrString("headers", ""))
+		if err != nil {
+			return nil, false, nil, "", err
+		}
+	}
+
+	dbName := node.GetAttrString("db", "")
+	dbNode := node.GetRoot().FindNode(dbName)
+	if dbNode == nil || !dbNode.IsTypeDbFile() {
+		return nil, false, nil, "", fmt.Errorf("db_file node '%s' not found", dbName)
+	}
+	db, _, err := node.app.base.ui.win.disk.OpenDb(dbNode.GetAttrString("path", ""))
+	if err != nil {
+		return nil, false, nil, "", fmt.Errorf("OpenDb() failed: %w", err)
+	}
+
+	table := node.GetAttrString("table", "embeddings")
+	if table == "" {
+		return nil, false, nil, "", fmt.Errorf("table is empty")
+	}
+
+	return props, llama, db, table, nil
 }
 
 func UiMap_Attrs(node *SANode) {
@@ -0,0 +1,196 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+// Live transcription of microphone node: audio -> VAD -> utterances -> whisper.cpp -> "transcript" attribute
+type SAMicStream struct {
+	vad *SAAudioVad
+
+	format   *audio.Format
+	bitDepth int
+
+	whisper_node string
+	jobs         []*SAJobWhisperCpp //in order of utterances
+
+	recording bool //false = waiting for last transcriptions
+
+	pending *SAMicStream //previous recording which still waits for transcriptions, its text goes first
+
+	//audio from file instead of device
+	inject       *audio.IntBuffer
+	inject_pos   int
+	inject_start float64
+}
+
+func NewSAMicStream(node *SANode) (*SAMicStream, error) {
+	st := &SAMicStream{recording: true}
+
+	st.whisper_node = node.GetAttrString("whisper_node", "")
+	wh := node.GetRoot().FindNode(st.whisper_node)
+	if wh == nil || !wh.IsTypeWhispercpp() {
+		return nil, fmt.Errorf("whispercpp node '%s' not found", st.whisper_node)
+	}
+
+	st.format = &audio.Format{NumChannels: 1, SampleRate: 44100}
+	st.bitDepth = 16
+
+	path := node.GetAttrString("inject_wav", "")
+	if path != "" {
+		var err error
+		st.inject, err = SAMicStream_readWav(path)
+		if err != nil {
+			return nil, err
+		}
+		st.format = st.inject.Format
+		st.bitDepth = st.inject.SourceBitDepth
+		st.inject_start = OsTime()
+	}
+
+	st.vad = NewSAAudioVad(st.format.SampleRate)
+	st.vad.Threshold = node.GetAttrFloat("vad_threshold", st.vad.Threshold)
+	st.vad.Silence_ms = node.GetAttrInt("vad_silence_ms", st.vad.Silence_ms)
+	st.vad.Min_ms = node.GetAttrInt("vad_min_ms", st.vad.Min_ms)
+	st.vad.Max_ms = node.GetAttrInt("vad_max_ms", st.vad.Max_ms)
+
+	return st, nil
+}
+
+// mono only
+func SAMicStream_readWav(path string) (*audio.IntBuffer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Open() failed: %w", err)
+	}
+	defer file.Close()
+
+	dec := wav.NewDecoder(file)
+	if !dec.IsValidFile() {
+		return nil, fmt.Errorf("'%s' is not valid WAV file", path)
+	}
+	buff, err := dec.FullPCMBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("FullPCMBuffer() failed: %w", err)
+	}
+	if buff.Format.NumChannels != 1 {
+		return nil, fmt.Errorf("'%s' must be mono, has %d channels", path, buff.Format.NumChannels)
+	}
+	return buff, nil
+}
+
+func (st *SAMicStream) IsInjected() bool {
+	return st.inject != nil
+}
+
+// audio from device
+func (st *SAMicStream) Add(node *SANode, data []int) {
+	if !st.recording {
+		return
+	}
+	for _, utt := range st.vad.Add(data) {
+		st.transcribe(node, utt)
+	}
+}
+
+// feeds injected audio in real-time speed. Returns false when file ends.
+func (st *SAMicStream) tickInject(node *SANode) bool {
+	end := int((OsTime() - st.inject_start) * float64(st.format.SampleRate))
+	end = OsMin(end, len(st.inject.Data))
+	if end > st.inject_pos {
+		st.Add(node, st.inject.Data[st.inject_pos:end])
+		st.inject_pos = end
+	}
+	return st.inject_pos < len(st.inject.Data)
+}
+
+func (st *SAMicStream) Flush(node *SANode) {
+	st.recording = false
+	utt := st.vad.Flush()
+	if utt != nil {
+		st.transcribe(node, utt)
+	}
+}
+
+func (st *SAMicStream) transcribe(node *SANode, samples []int) {
+	wh := node.GetRoot().FindNode(st.whisper_node)
+	if wh == nil {
+		node.SetError(fmt.Errorf("whispercpp node '%s' not found", st.whisper_node))
+		return
+	}
+	model, props, err := wh.getWhisperProps()
+	if err != nil {
+		node.SetError(err)
+		return
+	}
+	props.Response_format = "text"
+	props.No_cache = true
+
+	//WAV in memory
+	file := &OsWriterSeeker{}
+	enc := wav.NewEncoder(file, st.format.SampleRate, st.bitDepth, st.format.NumChannels, 1)
+	err = enc.Write(&audio.IntBuffer{Data: samples, Format: st.format, SourceBitDepth: st.bitDepth})
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		node.SetError(err)
+		return
+	}
+
+	jb := node.app.base.jobs.AddWhisper(node.app, NewSANodePath(node), model, InitOsBlob(file.buf.Bytes()), props)
+	st.jobs = append(st.jobs, jb)
+}
+
+// appends finished transcriptions(in order) into "transcript" attribute. Returns false when stream is finished.
+func (st *SAMicStream) Tick(node *SANode) bool {
+	if st.pending != nil {
+		if st.pending.Tick(node) {
+			return true //keep order
+		}
+		st.pending = nil
+	}
+
+	for len(st.jobs) > 0 && st.jobs[0].done.Load() {
+		jb := st.jobs[0]
+		st.jobs = st.jobs[1:]
+
+		if jb.outErr != nil {
+			node.SetError(jb.outErr)
+			continue
+		}
+
+		text := strings.TrimSpace(string(jb.output))
+		if text == "" {
+			continue
+		}
+		transcript := node.GetAttrString("transcript", "")
+		if transcript != "" {
+			transcript += " "
+		}
+		node.Attrs["transcript"] = transcript + text
+		node.SetChange([]SANodeCodeExePrm{{Node: node.Name, Attr: "transcript_part", Value: text}})
+	}
+	return st.recording || len(st.jobs) > 0
+}
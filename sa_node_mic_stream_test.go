@@ -0,0 +1,135 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+// tone, silence, tone, silence
+func testMicStream_writeWav(t *testing.T, channels int) string {
+	const rate = 16000
+	var data []int
+	for _, voice := range []bool{true, false, true, false} {
+		for i := 0; i < rate; i++ {
+			v := 0
+			if voice {
+				v = int(10000 * math.Sin(2*math.Pi*440*float64(i)/rate))
+			}
+			for c := 0; c < channels; c++ {
+				data = append(data, v)
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "inject.wav")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	enc := wav.NewEncoder(file, rate, 16, channels, 1)
+	err = enc.Write(&audio.IntBuffer{Data: data, Format: &audio.Format{NumChannels: channels, SampleRate: rate}, SourceBitDepth: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = enc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSAMicStream_injectWav(t *testing.T) {
+	buff, err := SAMicStream_readWav(testMicStream_writeWav(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buff.Format.SampleRate != 16000 || len(buff.Data) != 4*16000 {
+		t.Fatalf("unexpected wav: rate %d, samples %d", buff.Format.SampleRate, len(buff.Data))
+	}
+
+	//same chunks as tickInject()
+	vad := NewSAAudioVad(buff.Format.SampleRate)
+	n := 0
+	for st := 0; st < len(buff.Data); st += 1600 {
+		n += len(vad.Add(buff.Data[st:OsMin(st+1600, len(buff.Data))]))
+	}
+	if vad.Flush() != nil {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 utterances, got %d", n)
+	}
+
+	_, err = SAMicStream_readWav(testMicStream_writeWav(t, 2))
+	if err == nil {
+		t.Fatal("stereo wav must be rejected")
+	}
+}
+
+func TestSAMicStream_restartKeepsOrder(t *testing.T) {
+	//without base, so NewSANode() can't be used
+	app := &SAApp{}
+	app.root = &SANode{app: app, Name: "root", Exe: "layout", Attrs: make(map[string]interface{})}
+	app.exe = app.root
+	node := &SANode{app: app, parent: app.root, Name: "mic", Exe: "microphone", Attrs: make(map[string]interface{})}
+	app.root.Subs = append(app.root.Subs, node)
+
+	newJob := func(text string) *SAJobWhisperCpp {
+		return &SAJobWhisperCpp{output: []byte(text)}
+	}
+
+	//first recording was stopped, but its transcription is still running
+	j1 := newJob("first")
+	old := &SAMicStream{jobs: []*SAJobWhisperCpp{j1}}
+
+	//second recording started
+	j2 := newJob("second")
+	j2.done.Store(true)
+	st := &SAMicStream{recording: true, pending: old, jobs: []*SAJobWhisperCpp{j2}}
+
+	if !st.Tick(node) {
+		t.Fatal("stream must continue")
+	}
+	if tr := node.GetAttrString("transcript", ""); tr != "" {
+		t.Fatalf("second text must wait for first one, got '%s'", tr)
+	}
+
+	j1.done.Store(true)
+	if !st.Tick(node) {
+		t.Fatal("stream is still recording")
+	}
+	if tr := node.GetAttrString("transcript", ""); tr != "first second" {
+		t.Fatalf("expected 'first second', got '%s'", tr)
+	}
+	if st.pending != nil {
+		t.Fatal("finished pending stream must be removed")
+	}
+
+	st.recording = false
+	if st.Tick(node) {
+		t.Fatal("stream must be finished")
+	}
+}
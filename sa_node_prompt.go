@@ -0,0 +1,370 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const SANodePrompt_maxVersions = 50
+
+var g_prompt_varTypes = []string{"string", "int", "float", "bool", "json"}
+
+type SANodePromptVar struct {
+	Name  string
+	Type  string //"string", "int", "float", "bool", "json"
+	Value string //constant or "{node.attr}"
+}
+
+type SANodePromptVersion struct {
+	System string
+	User   string
+	Time   int64 //unix
+}
+
+// text can include variables: "Summarize this: {{text}}"
+type SANodePromptTemplate struct {
+	Name     string
+	System   string
+	User     string
+	Versions []SANodePromptVersion `json:",omitempty"` //older first
+}
+
+type SANodePrompt struct {
+	Templates []*SANodePromptTemplate
+	Vars      []*SANodePromptVar `json:",omitempty"`
+	Selected  int                //template shown in attributes
+}
+
+func (node *SANode) getPrompt() *SANodePrompt {
+	if node.Prompt == nil {
+		node.Prompt = &SANodePrompt{}
+	}
+	if len(node.Prompt.Templates) == 0 {
+		node.Prompt.Templates = append(node.Prompt.Templates, &SANodePromptTemplate{Name: "default", System: SAService_defaultSystemPrompt})
+	}
+	if node.Prompt.Selected < 0 || node.Prompt.Selected >= len(node.Prompt.Templates) {
+		node.Prompt.Selected = 0
+	}
+	return node.Prompt
+}
+
+// empty name = first template
+func (pr *SANodePrompt) FindTemplate(name string) *SANodePromptTemplate {
+	if name == "" && len(pr.Templates) > 0 {
+		return pr.Templates[0]
+	}
+	for _, t := range pr.Templates {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (pr *SANodePrompt) GetTemplateNames() []string {
+	var names []string
+	for _, t := range pr.Templates {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// old text is saved into history
+func (t *SANodePromptTemplate) SetText(system string, user string) bool {
+	if t.System == system && t.User == user {
+		return false
+	}
+
+	t.Versions = append(t.Versions, SANodePromptVersion{System: t.System, User: t.User, Time: time.Now().Unix()})
+	if len(t.Versions) > SANodePrompt_maxVersions {
+		t.Versions = t.Versions[len(t.Versions)-SANodePrompt_maxVersions:]
+	}
+
+	t.System = system
+	t.User = user
+	return true
+}
+
+func SANodePrompt_convert(v *SANodePromptVar, value interface{}) (string, error) {
+	str := _SANodeBind_toString(value)
+
+	switch v.Type {
+	case "int":
+		_, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil {
+			return "", fmt.Errorf("variable '%s' is not int: '%s'", v.Name, str)
+		}
+	case "float":
+		_, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err != nil {
+			return "", fmt.Errorf("variable '%s' is not float: '%s'", v.Name, str)
+		}
+	case "bool":
+		b, err := strconv.ParseBool(strings.TrimSpace(str))
+		if err != nil {
+			return "", fmt.Errorf("variable '%s' is not bool: '%s'", v.Name, str)
+		}
+		str = strconv.FormatBool(b)
+	case "json":
+		js, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("variable '%s' Marshal() failed: %w", v.Name, err)
+		}
+		str = string(js)
+	}
+	return str, nil
+}
+
+// variables filled from other nodes' attributes
+func (node *SANode) resolvePromptVars() (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, v := range node.getPrompt().Vars {
+		value, err := node.resolveBind(v.Value)
+		if err != nil {
+			return nil, fmt.Errorf("variable '%s': %w", v.Name, err)
+		}
+		vars[v.Name], err = SANodePrompt_convert(v, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return vars, nil
+}
+
+func SANodePrompt_render(tmpl string, vars map[string]string) (string, error) {
+	str := ""
+	for {
+		st := strings.Index(tmpl, "{{")
+		if st < 0 {
+			break
+		}
+		en := strings.Index(tmpl[st:], "}}")
+		if en < 0 {
+			break
+		}
+		en += st
+
+		name := strings.TrimSpace(tmpl[st+2 : en])
+		value, found := vars[name]
+		if !found {
+			return "", fmt.Errorf("variable '%s' not found", name)
+		}
+		str += tmpl[:st] + value
+		tmpl = tmpl[en+2:]
+	}
+	return str + tmpl, nil
+}
+
+func (node *SANode) RenderPrompt(templateName string) (string, string, error) {
+	t := node.getPrompt().FindTemplate(templateName)
+	if t == nil {
+		return "", "", fmt.Errorf("template '%s' not found in prompt '%s'", templateName, node.Name)
+	}
+
+	vars, err := node.resolvePromptVars()
+	if err != nil {
+		return "", "", err
+	}
+
+	system, err := SANodePrompt_render(t.System, vars)
+	if err != nil {
+		return "", "", fmt.Errorf("system: %w", err)
+	}
+	user, err := SANodePrompt_render(t.User, vars)
+	if err != nil {
+		return "", "", fmt.Errorf("user: %w", err)
+	}
+	return system, user, nil
+}
+
+// llamacpp/openai node has attributes 'prompt'(node name) and 'prompt_template'
+func (node *SANode) getPromptNode() (*SANode, error) {
+	name := node.GetAttrString("prompt", "")
+	if name == "" {
+		return nil, nil
+	}
+	pn := node.GetRoot().FindNode(name)
+	if pn == nil || !pn.IsTypePrompt() {
+		return nil, fmt.Errorf("prompt node '%s' not found", name)
+	}
+	return pn, nil
+}
+
+func (node *SANode) showAttrPrompt(grid *OsV4) {
+	var prompts []string
+	prompts = append(prompts, "") //none
+	for _, nd := range node.app.all_nodes {
+		if nd.IsTypePrompt() {
+			prompts = append(prompts, nd.Name)
+		}
+	}
+	node.ShowAttrStringCombo(grid, "prompt", "", prompts, prompts)
+
+	pn, err := node.getPromptNode()
+	if err != nil {
+		node.SetError(err)
+		return
+	}
+	if pn != nil {
+		names := pn.getPrompt().GetTemplateNames()
+		node.ShowAttrStringCombo(grid, "prompt_template", names[0], names, names)
+	}
+}
+
+func UiPrompt_Attrs(node *SANode) {
+	ui := node.app.base.ui
+	ui.Div_colMax(0, 3)
+	ui.Div_colMax(1, 100)
+
+	pr := node.getPrompt()
+	t := pr.Templates[pr.Selected]
+	y := 0
+
+	//templates
+	ui.Comp_text(0, y, 1, 1, "template", 0)
+	ui.Div_start(1, y, 1, 1)
+	{
+		ui.Div_colMax(0, 100)
+		ui.Div_col(1, 2)
+		ui.Div_col(2, 2)
+
+		names := pr.GetTemplateNames()
+		sel := t.Name
+		if ui.Comp_combo(0, 0, 1, 1, &sel, names, names, "", true, false) {
+			for i, it := range pr.Templates {
+				if it.Name == sel {
+					pr.Selected = i
+				}
+			}
+		}
+		if ui.Comp_buttonLight(1, 0, 1, 1, "+", Comp_buttonProp().Tooltip("Add template")) > 0 {
+			name := "template"
+			for i := 2; pr.FindTemplate(name) != nil; i++ {
+				name = "template_" + strconv.Itoa(i)
+			}
+			pr.Templates = append(pr.Templates, &SANodePromptTemplate{Name: name})
+			pr.Selected = len(pr.Templates) - 1
+			node.SetStructChange()
+		}
+		if ui.Comp_buttonLight(2, 0, 1, 1, ui.trns.REMOVE, Comp_buttonProp().Enable(len(pr.Templates) > 1).Confirmation("Are you sure?", "confirm_prompt_"+node.Name)) > 0 {
+			pr.Templates = append(pr.Templates[:pr.Selected], pr.Templates[pr.Selected+1:]...)
+			pr.Selected = 0
+			node.SetStructChange()
+			return
+		}
+	}
+	ui.Div_end()
+	y++
+
+	ui.Comp_text(0, y, 1, 1, "name", 0)
+	name := t.Name
+	_, _, _, fnshd, _ := ui.Comp_editbox(1, y, 1, 1, &name, Comp_editboxProp())
+	if fnshd && name != "" && pr.FindTemplate(name) == nil {
+		t.Name = name
+		node.SetStructChange()
+	}
+	y++
+
+	system := t.System
+	user := t.User
+	ui.Comp_text(0, y, 1, 1, "system", 0)
+	_, _, _, fnshd1, _ := ui.Comp_editbox(1, y, 1, 4, &system, Comp_editboxProp().Align(0, 0).MultiLine(true, true).Formating(false))
+	y += 4
+	ui.Comp_text(0, y, 1, 1, "user", 0)
+	_, _, _, fnshd2, _ := ui.Comp_editbox(1, y, 1, 4, &user, Comp_editboxProp().Align(0, 0).MultiLine(true, true).Formating(false))
+	y += 4
+	if (fnshd1 || fnshd2) && t.SetText(system, user) {
+		node.SetStructChange()
+	}
+
+	//variables
+	y++
+	ui.Comp_text(0, y, 1, 1, "**Variables**", 0)
+	if ui.Comp_buttonLight(1, y, 1, 1, "+", Comp_buttonProp().Tooltip("Add variable")) > 0 {
+		pr.Vars = append(pr.Vars, &SANodePromptVar{Name: "var_" + strconv.Itoa(len(pr.Vars)+1), Type: "string"})
+		node.SetStructChange()
+	}
+	y++
+	for i, v := range pr.Vars {
+		ui.Div_start(0, y, 2, 1)
+		{
+			ui.Div_colMax(0, 3)
+			ui.Div_colMax(1, 3)
+			ui.Div_colMax(2, 100)
+			ui.Div_col(3, 1)
+
+			_, _, _, fnshd, _ := ui.Comp_editbox(0, 0, 1, 1, &v.Name, Comp_editboxProp().Ghost("name"))
+			if fnshd {
+				node.SetStructChange()
+			}
+			if ui.Comp_combo(1, 0, 1, 1, &v.Type, g_prompt_varTypes, g_prompt_varTypes, "", true, false) {
+				node.SetStructChange()
+			}
+			_, _, _, fnshd, _ = ui.Comp_editbox(2, 0, 1, 1, &v.Value, Comp_editboxProp().Ghost("value or {node.attr}"))
+			if fnshd {
+				node.SetStructChange()
+			}
+			if ui.Comp_buttonLight(3, 0, 1, 1, "X", Comp_buttonProp().Tooltip(ui.trns.REMOVE)) > 0 {
+				pr.Vars = append(pr.Vars[:i], pr.Vars[i+1:]...)
+				node.SetStructChange()
+				ui.Div_end()
+				return
+			}
+		}
+		ui.Div_end()
+		y++
+	}
+
+	//preview
+	y++
+	sys, usr, err := node.RenderPrompt(t.Name)
+	if err != nil {
+		node.SetError(err)
+	} else {
+		ui.Comp_text(0, y, 1, 1, "preview", 0)
+		ui.Comp_textSelectMulti(1, y, 1, 4, "System: "+sys+"\n\nUser: "+usr, 1.0, OsV2{0, 0}, true, true, false, true)
+		y += 4
+	}
+
+	//history
+	y++
+	ui.Comp_text(0, y, 1, 1, fmt.Sprintf("**History(%d)**", len(t.Versions)), 0)
+	y++
+	for i := len(t.Versions) - 1; i >= 0; i-- {
+		ver := t.Versions[i]
+		ui.Div_start(0, y, 2, 1)
+		{
+			ui.Div_colMax(0, 5)
+			ui.Div_colMax(1, 100)
+			ui.Div_col(2, 2)
+
+			ui.Comp_text(0, 0, 1, 1, ui.GetTextDateTime(ver.Time), 0)
+			ui.Comp_text(1, 0, 1, 1, strings.ReplaceAll(ver.System+" | "+ver.User, "\n", " "), 0)
+			if ui.Comp_buttonLight(2, 0, 1, 1, "Restore", Comp_buttonProp()) > 0 {
+				t.SetText(ver.System, ver.User)
+				node.SetStructChange()
+			}
+		}
+		ui.Div_end()
+		y++
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// API keys, tokens, passwords. Nodes use only names, so values are not saved in app.json
+type SASecrets struct {
+	items map[string]string
+	lock  sync.Mutex
+
+	new_name  string
+	new_value string
+}
+
+func SASecrets_path() string {
+	return "services/secrets.json"
+}
+
+func NewSASecrets() *SASecrets {
+	sec := &SASecrets{items: make(map[string]string)}
+
+	js, err := os.ReadFile(SASecrets_path())
+	if err == nil {
+		err = json.Unmarshal(js, &sec.items)
+		if err != nil {
+			fmt.Printf("warnning: Unmarshal() failed: %v\n", err)
+		}
+		sec.chmod() //file could be created by older version
+	}
+	return sec
+}
+
+// call with lock
+func (sec *SASecrets) save() {
+	js, err := json.MarshalIndent(sec.items, "", "")
+	if err != nil {
+		fmt.Printf("MarshalIndent() failed: %v\n", err)
+		return
+	}
+	OsFolderCreate("services")
+	err = os.WriteFile(SASecrets_path(), js, 0600) //only user can read it
+	if err != nil {
+		fmt.Printf("WriteFile() failed: %v\n", err)
+		return
+	}
+	sec.chmod() //WriteFile() doesn't change permissions of existing file
+}
+
+func (sec *SASecrets) chmod() {
+	err := os.Chmod(SASecrets_path(), 0600)
+	if err != nil {
+		fmt.Printf("Chmod() failed: %v\n", err)
+	}
+}
+
+func (sec *SASecrets) Get(name string) (string, error) {
+	sec.lock.Lock()
+	defer sec.lock.Unlock()
+
+	value, found := sec.items[name]
+	if !found {
+		return "", fmt.Errorf("secret '%s' not found. Add it in Menu:Settings:Secrets", name)
+	}
+	return value, nil
+}
+
+func (sec *SASecrets) Set(name string, value string) {
+	sec.lock.Lock()
+	defer sec.lock.Unlock()
+
+	sec.items[name] = value
+	sec.save()
+}
+
+func (sec *SASecrets) Remove(name string) {
+	sec.lock.Lock()
+	defer sec.lock.Unlock()
+
+	delete(sec.items, name)
+	sec.save()
+}
+
+func (sec *SASecrets) GetNames() []string {
+	sec.lock.Lock()
+	defer sec.lock.Unlock()
+
+	var names []string
+	for name := range sec.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// first and last 3 characters are visible
+func SASecrets_mask(value string) string {
+	if len(value) <= 6 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:3] + strings.Repeat("*", len(value)-6) + value[len(value)-3:]
+}
+
+func (sec *SASecrets) RenderBrowser(ui *Ui) {
+	ui.Div_colMax(0, 30)
+	ui.Div_rowMax(1, 15)
+
+	//add
+	ui.Div_start(0, 0, 1, 1)
+	{
+		ui.Div_colMax(0, 8)
+		ui.Div_colMax(1, 100)
+		ui.Div_colMax(2, 3)
+
+		ui.Comp_editbox(0, 0, 1, 1, &sec.new_name, Comp_editboxProp().Ghost("name").TempToValue(true))
+		ui.Comp_editbox(1, 0, 1, 1, &sec.new_value, Comp_editboxProp().Ghost("value").TempToValue(true).Formating(false))
+		if ui.Comp_button(2, 0, 1, 1, "Add", Comp_buttonProp().Enable(sec.new_name != "" && sec.new_value != "")) > 0 {
+			sec.Set(sec.new_name, sec.new_value)
+			sec.new_name = ""
+			sec.new_value = ""
+		}
+	}
+	ui.Div_end()
+
+	//list
+	ui.Div_start(0, 1, 1, 1)
+	{
+		ui.Div_colMax(0, 8)
+		ui.Div_colMax(1, 100)
+		ui.Div_col(2, 1)
+
+		names := sec.GetNames()
+		if len(names) == 0 {
+			ui.Comp_text(0, 0, 3, 1, "No secrets", 1)
+		}
+		for y, name := range names {
+			value, _ := sec.Get(name)
+			ui.Comp_text(0, y, 1, 1, name, 0)
+			ui.Comp_text(1, y, 1, 1, SASecrets_mask(value), 0)
+			if ui.Comp_buttonLight(2, y, 1, 1, "X", Comp_buttonProp().Tooltip(ui.trns.REMOVE).Confirmation("Are you sure?", "confirm_secret_remove_"+name)) > 0 {
+				sec.Remove(name)
+			}
+		}
+	}
+	ui.Div_end()
+}
@@ -0,0 +1,321 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const SAServiceCache_trimEvery = 50 //puts
+
+// Results of llama.cpp, OpenAI, whisper.cpp and embeddings. Every entry is written immediately, so crash doesn't lose it.
+type SAServiceCache struct {
+	jobs *SAJobs
+	db   *DiskDb
+
+	puts atomic.Int64
+
+	//UI
+	search string
+
+	//browser snapshot, refreshed after edit or every second, not every frame
+	view_search string
+	view_tick   int64
+	view_items  []SAServiceCacheItem
+	view_err    error
+	view_n      int64
+	view_bytes  int64
+}
+
+type SAServiceCacheItem struct {
+	Key       string
+	Service   string
+	Request   string
+	Size      int64
+	Created   int64
+	Last_used int64
+}
+
+func SAServiceCache_path() string {
+	return "services/cache.sqlite"
+}
+
+func NewSAServiceCache(jobs *SAJobs) (*SAServiceCache, error) {
+	c := &SAServiceCache{jobs: jobs}
+
+	var err error
+	c.db, _, err = jobs.base.ui.win.disk.OpenDb(SAServiceCache_path())
+	if err != nil {
+		return nil, fmt.Errorf("OpenDb() failed: %w", err)
+	}
+
+	_, err = c.db.Write("CREATE TABLE IF NOT EXISTS cache(key TEXT PRIMARY KEY, service TEXT NOT NULL, request TEXT NOT NULL, value BLOB, size INTEGER NOT NULL, created INTEGER NOT NULL, last_used INTEGER NOT NULL)")
+	if err != nil {
+		return nil, fmt.Errorf("Write() failed: %w", err)
+	}
+	_, err = c.db.Write("CREATE INDEX IF NOT EXISTS cache_last_used ON cache(last_used)")
+	if err != nil {
+		return nil, fmt.Errorf("Write() failed: %w", err)
+	}
+
+	//old caches
+	c.importJson("llamacpp", "services/llama.cpp.json")
+	c.importJson("openai", "services/openai.json")
+	c.importJson("whispercpp", "services/whisper.cpp.json")
+
+	err = c.Trim()
+	if err != nil {
+		fmt.Printf("Trim() failed: %v\n", err)
+	}
+
+	return c, nil
+}
+
+func (c *SAServiceCache) importJson(service string, path string) {
+	js, err := os.ReadFile(path)
+	if err != nil {
+		return //not exist
+	}
+
+	items := make(map[string][]byte)
+	err = json.Unmarshal(js, &items)
+	if err != nil {
+		fmt.Printf("importJson(%s) failed: %v\n", path, err)
+		return
+	}
+	for key, value := range items {
+		c.Put(service, key, "(imported)", value)
+	}
+
+	os.Remove(path)
+}
+
+func (c *SAServiceCache) Get(service string, key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	now := time.Now().Unix()
+	ttl := c.getTTL()
+
+	var value []byte
+	var created int64
+	c.db.Lock()
+	err := c.db.ReadRow_unsafe("SELECT value, created FROM cache WHERE key=? AND service=?", key, service).Scan(&value, &created)
+	c.db.Unlock()
+	if err != nil {
+		return nil, false //not found
+	}
+	if ttl > 0 && created < now-ttl {
+		return nil, false //expired, removed by Trim()
+	}
+
+	c.db.Write("UPDATE cache SET last_used=? WHERE key=?", now, key)
+	return value, true
+}
+
+// request is short description for browsing
+func (c *SAServiceCache) Put(service string, key string, request string, value []byte) {
+	if c == nil {
+		return
+	}
+
+	if len(request) > 500 {
+		n := 500
+		for n > 0 && !utf8.RuneStart(request[n]) {
+			n-- //don't split character
+		}
+		request = request[:n]
+	}
+
+	now := time.Now().Unix()
+	_, err := c.db.Write("INSERT OR REPLACE INTO cache(key, service, request, value, size, created, last_used) VALUES(?, ?, ?, ?, ?, ?, ?)", key, service, request, value, len(value), now, now)
+	if err != nil {
+		fmt.Printf("cache Put() failed: %v\n", err)
+		return
+	}
+
+	if c.puts.Add(1)%SAServiceCache_trimEvery == 0 {
+		err = c.Trim()
+		if err != nil {
+			fmt.Printf("Trim() failed: %v\n", err)
+		}
+	}
+}
+
+func (c *SAServiceCache) getTTL() int64 {
+	return int64(c.jobs.base.ui.win.io.ini.Cache_ttl_days) * 24 * 3600
+}
+func (c *SAServiceCache) getMaxBytes() int64 {
+	return int64(c.jobs.base.ui.win.io.ini.Cache_max_mb) * 1024 * 1024
+}
+
+// removes expired entries and least recently used ones over size limit
+func (c *SAServiceCache) Trim() error {
+	ttl := c.getTTL()
+	if ttl > 0 {
+		_, err := c.db.Write("DELETE FROM cache WHERE created < ?", time.Now().Unix()-ttl)
+		if err != nil {
+			return err
+		}
+	}
+
+	maxBytes := c.getMaxBytes()
+	if maxBytes > 0 {
+		_, total := c.GetStats()
+		if total > maxBytes {
+			//delete oldest until it fits
+			_, err := c.db.Write("DELETE FROM cache WHERE key IN (SELECT key FROM (SELECT key, SUM(size) OVER (ORDER BY last_used DESC) AS total FROM cache) WHERE total > ?)", maxBytes)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *SAServiceCache) GetStats() (int64, int64) {
+	var n, bytes int64
+	c.db.Lock()
+	c.db.ReadRow_unsafe("SELECT COUNT(*), COALESCE(SUM(size), 0) FROM cache").Scan(&n, &bytes)
+	c.db.Unlock()
+	return n, bytes
+}
+
+func (c *SAServiceCache) List(search string, limit int) ([]SAServiceCacheItem, error) {
+	c.db.Lock()
+	defer c.db.Unlock()
+
+	rows, err := c.db.Read_unsafe("SELECT key, service, request, size, created, last_used FROM cache WHERE request LIKE ? OR service LIKE ? ORDER BY last_used DESC LIMIT ?", "%"+search+"%", "%"+search+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []SAServiceCacheItem
+	for rows.Next() {
+		var it SAServiceCacheItem
+		err = rows.Scan(&it.Key, &it.Service, &it.Request, &it.Size, &it.Created, &it.Last_used)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+func (c *SAServiceCache) Remove(key string) error {
+	_, err := c.db.Write("DELETE FROM cache WHERE key=?", key)
+	return err
+}
+
+// service "" = all
+func (c *SAServiceCache) RemoveService(service string) error {
+	_, err := c.db.Write("DELETE FROM cache WHERE service=? OR ?=''", service, service)
+	return err
+}
+
+func (c *SAServiceCache) refreshView() {
+	if c.view_tick != 0 && c.view_search == c.search && OsIsTicksIn(c.view_tick, 1000) {
+		return
+	}
+	c.view_search = c.search
+	c.view_tick = OsTicks()
+	c.view_n, c.view_bytes = c.GetStats()
+	c.view_items, c.view_err = c.List(c.search, 100)
+}
+
+func (c *SAServiceCache) RenderBrowser() {
+	ui := c.jobs.base.ui
+
+	ui.Div_colMax(0, 30)
+	ui.Div_rowMax(2, 15)
+
+	c.refreshView()
+	n, bytes := c.view_n, c.view_bytes
+
+	//header
+	ui.Div_start(0, 0, 1, 1)
+	{
+		ui.Div_colMax(0, 100)
+		ui.Div_colMax(1, 10)
+		ui.Div_colMax(2, 4)
+
+		ui.Comp_editbox(0, 0, 1, 1, &c.search, Comp_editboxProp().Ghost(ui.trns.SEARCH).TempToValue(true))
+		ui.Comp_text(1, 0, 1, 1, fmt.Sprintf("%d items, %.1fMB", n, float64(bytes)/1024/1024), 1)
+		if ui.Comp_button(2, 0, 1, 1, "Remove all", Comp_buttonProp().SetError(true).Confirmation("Are you sure?", "confirm_cache_remove_all")) > 0 {
+			c.RemoveService("")
+			c.view_tick = 0
+		}
+	}
+	ui.Div_end()
+
+	//per service
+	ui.Div_start(0, 1, 1, 1)
+	{
+		services := []string{"llamacpp", "openai", "whispercpp", "embeddings", "tts"}
+		for i, srv := range services {
+			ui.Div_colMax(i, 100)
+			if ui.Comp_buttonLight(i, 0, 1, 1, "Remove "+srv, Comp_buttonProp()) > 0 {
+				c.RemoveService(srv)
+				c.view_tick = 0
+			}
+		}
+	}
+	ui.Div_end()
+
+	//list
+	ui.Div_start(0, 2, 1, 1)
+	{
+		ui.Div_colMax(0, 3)
+		ui.Div_colMax(1, 100)
+		ui.Div_colMax(2, 3)
+		ui.Div_colMax(3, 5)
+		ui.Div_col(4, 1)
+
+		if c.view_err != nil {
+			ui.Comp_text(0, 0, 5, 1, c.view_err.Error(), 0)
+		}
+		for y, it := range c.view_items {
+			ui.Comp_text(0, y, 1, 1, it.Service, 0)
+			ui.Comp_text(1, y, 1, 1, strings.ReplaceAll(it.Request, "\n", " "), 0)
+			ui.Comp_text(2, y, 1, 1, fmt.Sprintf("%.1fKB", float64(it.Size)/1024), 2)
+			ui.Comp_text(3, y, 1, 1, ui.GetTextDateTime(it.Last_used), 2)
+			if ui.Comp_buttonLight(4, y, 1, 1, "X", Comp_buttonProp().Tooltip(ui.trns.REMOVE)) > 0 {
+				c.Remove(it.Key)
+				c.view_tick = 0
+			}
+		}
+	}
+	ui.Div_end()
+}
+
+// last user message, describes request in browser
+func SAService_lastUserMsg(msgs []SAServiceMsg) string {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "user" {
+			return msgs[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const SAServiceContext_msgOverhead = 4 //role, separators
+
+// pin_system = drop oldest messages, but keep system ones
+var g_context_strategies = []string{"pin_system", "drop_oldest", "summarize_older", "none"}
+
+// context length of OpenAI models
+var g_oia_contextSizes = map[string]int{"gpt-3.5-turbo": 16385, "gpt-4": 8192, "gpt-4-turbo-preview": 128000}
+
+// USD per 1M tokens: input, output
+var g_oia_prices = map[string][2]float64{"gpt-3.5-turbo": {0.5, 1.5}, "gpt-4": {30, 60}, "gpt-4-turbo-preview": {10, 30}}
+
+type SAServiceUsage struct {
+	Prompt_tokens     int
+	Completion_tokens int
+	Budget            int
+	Dropped_msgs      int
+	Summarized        bool
+	Cost              float64 //USD, only OpenAI
+}
+
+func (u *SAServiceUsage) String() string {
+	str := fmt.Sprintf("%d + %d tokens", u.Prompt_tokens, u.Completion_tokens)
+	if u.Budget > 0 {
+		str += fmt.Sprintf(" / %d", u.Budget)
+	}
+	if u.Dropped_msgs > 0 {
+		str += fmt.Sprintf(", %d messages dropped", u.Dropped_msgs)
+	}
+	if u.Summarized {
+		str += ", older messages summarized"
+	}
+	if u.Cost > 0 {
+		str += fmt.Sprintf(", ~$%.4f", u.Cost)
+	}
+	return str
+}
+
+// sums rounds of tool calling
+func (u *SAServiceUsage) Add(round *SAServiceUsage) {
+	u.Prompt_tokens += round.Prompt_tokens
+	u.Completion_tokens += round.Completion_tokens
+	u.Budget = round.Budget
+	u.Dropped_msgs = OsMax(u.Dropped_msgs, round.Dropped_msgs)
+	u.Summarized = u.Summarized || round.Summarized
+	u.Cost += round.Cost
+}
+
+func SAServiceOpenAI_getCost(model string, prompt_tokens int, completion_tokens int) float64 {
+	price, found := g_oia_prices[model]
+	if !found {
+		return 0
+	}
+	return (float64(prompt_tokens)*price[0] + float64(completion_tokens)*price[1]) / 1000000
+}
+
+// rough estimation for servers without tokenizer endpoint
+func SAService_estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// Fits messages into context window
+type SAServiceContext struct {
+	Budget   int //prompt + answer
+	Reserve  int //answer
+	Strategy string
+
+	count     func(text string) (int, error)
+	summarize func(msgs []SAServiceMsg) (string, error)
+}
+
+func (ctx *SAServiceContext) countMsg(msg *SAServiceMsg) (int, error) {
+	n, err := ctx.count(msg.Content)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range msg.Tool_calls {
+		m, err := ctx.count(c.Function.Name + c.Function.Arguments)
+		if err != nil {
+			return 0, err
+		}
+		n += m
+	}
+	return n + SAServiceContext_msgOverhead, nil
+}
+
+func (ctx *SAServiceContext) countMsgs(msgs []SAServiceMsg) (int, []int, error) {
+	sum := 0
+	counts := make([]int, len(msgs))
+	for i := range msgs {
+		n, err := ctx.countMsg(&msgs[i])
+		if err != nil {
+			return 0, nil, err
+		}
+		counts[i] = n
+		sum += n
+	}
+	return sum, counts, nil
+}
+
+// returns messages which fit into budget, usage is filled
+func (ctx *SAServiceContext) Fit(msgs []SAServiceMsg, usage *SAServiceUsage) ([]SAServiceMsg, error) {
+	total, counts, err := ctx.countMsgs(msgs)
+	if err != nil {
+		return nil, fmt.Errorf("count() failed: %w", err)
+	}
+
+	usage.Budget = ctx.Budget
+	usage.Prompt_tokens = total
+	if ctx.Budget <= 0 {
+		return msgs, nil //unknown
+	}
+
+	limit := ctx.Budget - ctx.Reserve
+	if limit <= 0 {
+		return nil, fmt.Errorf("context budget(%d) is smaller than answer reserve(%d)", ctx.Budget, ctx.Reserve)
+	}
+	if total <= limit {
+		return msgs, nil
+	}
+
+	switch ctx.Strategy {
+	case "none":
+		//nothing
+
+	case "summarize_older":
+		msgs, counts, err = ctx.summarizeOlder(msgs, counts, limit, usage)
+		if err != nil {
+			return nil, err
+		}
+		msgs, counts = ctx.dropOldest(msgs, counts, limit, true, usage)
+
+	case "drop_oldest":
+		msgs, counts = ctx.dropOldest(msgs, counts, limit, false, usage)
+
+	default: //pin_system
+		msgs, counts = ctx.dropOldest(msgs, counts, limit, true, usage)
+	}
+
+	total = 0
+	for _, n := range counts {
+		total += n
+	}
+	usage.Prompt_tokens = total
+	if total > limit {
+		return nil, fmt.Errorf("prompt has %d tokens, but context budget is %d(%d reserved for answer). Change 'context_strategy' or 'context_budget'", total, ctx.Budget, ctx.Reserve)
+	}
+	return msgs, nil
+}
+
+// last message is always kept
+func (ctx *SAServiceContext) dropOldest(msgs []SAServiceMsg, counts []int, limit int, pinSystem bool, usage *SAServiceUsage) ([]SAServiceMsg, []int) {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+
+	for total > limit {
+		//find oldest
+		i := -1
+		for j := 0; j < len(msgs)-1; j++ {
+			if !pinSystem || msgs[j].Role != "system" {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			break //nothing to drop
+		}
+
+		//tool results without call are rejected by servers
+		end := i + 1
+		for end < len(msgs)-1 && msgs[end].Role == "tool" {
+			end++
+		}
+
+		for j := i; j < end; j++ {
+			total -= counts[j]
+			usage.Dropped_msgs++
+		}
+		msgs = append(msgs[:i:i], msgs[end:]...)
+		counts = append(counts[:i:i], counts[end:]...)
+	}
+	return msgs, counts
+}
+
+// older half of conversation is replaced with summary
+func (ctx *SAServiceContext) summarizeOlder(msgs []SAServiceMsg, counts []int, limit int, usage *SAServiceUsage) ([]SAServiceMsg, []int, error) {
+	if ctx.summarize == nil {
+		return msgs, counts, nil
+	}
+
+	//keep newest messages which fit into half of limit
+	keep := 0
+	recent := 0
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "system" {
+			continue
+		}
+		if recent+counts[i] > limit/2 && keep > 0 {
+			break
+		}
+		recent += counts[i]
+		keep = len(msgs) - i
+	}
+	if keep == 0 {
+		return msgs, counts, nil //only system messages
+	}
+	//tool results must stay with their call
+	for keep < len(msgs) && msgs[len(msgs)-keep].Role == "tool" {
+		keep++
+	}
+
+	var system []SAServiceMsg
+	var older []SAServiceMsg
+	for i := 0; i < len(msgs)-keep; i++ {
+		if msgs[i].Role == "system" {
+			system = append(system, msgs[i])
+		} else {
+			older = append(older, msgs[i])
+		}
+	}
+	if len(older) == 0 {
+		return msgs, counts, nil
+	}
+
+	summary, err := ctx.summarize(older)
+	if err != nil {
+		return nil, nil, fmt.Errorf("summarize() failed: %w", err)
+	}
+	usage.Summarized = true
+
+	out := system
+	out = append(out, SAServiceMsg{Role: "system", Content: "Summary of earlier conversation: " + summary})
+	out = append(out, msgs[len(msgs)-keep:]...)
+
+	_, outCounts, err := ctx.countMsgs(out)
+	if err != nil {
+		return nil, nil, fmt.Errorf("count() failed: %w", err)
+	}
+	return out, outCounts, nil
+}
+
+// messages for summarization request
+func SAServiceContext_summaryMessages(older []SAServiceMsg) []SAServiceMsg {
+	var sb strings.Builder
+	for _, m := range older {
+		if m.Content == "" {
+			continue
+		}
+		sb.WriteString(m.Role)
+		sb.WriteString(": ")
+		sb.WriteString(m.Content)
+		sb.WriteString("\n")
+	}
+
+	return []SAServiceMsg{
+		{Role: "system", Content: "Summarize the following conversation. Keep facts, names, numbers and decisions. Answer only with the summary."},
+		{Role: "user", Content: sb.String()},
+	}
+}
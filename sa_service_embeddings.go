@@ -0,0 +1,378 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const SAServiceEmbeddings_batch = 32
+
+type SAServiceEmbeddingsProps struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+
+	Url     string            `json:"-"` //OpenAI compatible base url, "http://127.0.0.1:8091/v1/"
+	Headers map[string]string `json:"-"`
+
+	local bool //llama.cpp server started by SkyAlt, Url has new port after every start
+}
+
+type SAServiceEmbeddingsResult struct {
+	Table string  `json:"table"`
+	Rowid int64   `json:"rowid"`
+	Score float64 `json:"score"` //cosine similarity
+}
+
+type SAServiceEmbeddings struct {
+	jobs *SAJobs
+	lock sync.Mutex
+}
+
+func NewSAServiceEmbeddings(jobs *SAJobs) *SAServiceEmbeddings {
+	emb := &SAServiceEmbeddings{jobs: jobs}
+	return emb
+}
+func (emb *SAServiceEmbeddings) Destroy() {
+}
+
+// same model + text = same vector. Url is part of key only for remote servers
+func (emb *SAServiceEmbeddings) cacheKey(props *SAServiceEmbeddingsProps, text string) string {
+	key := props.Model + "\n" + text
+	if !props.local {
+		key = props.Url + "\n" + key
+	}
+	hash, _ := InitOsHash([]byte(key))
+	return hash.Hex()
+}
+
+// returns normalized vectors for props.Input. Only texts which are not in cache are sent to server.
+func (emb *SAServiceEmbeddings) Embed(props *SAServiceEmbeddingsProps, stop *atomic.Bool) ([][]float32, error) {
+	emb.lock.Lock()
+	defer emb.lock.Unlock()
+
+	out := make([][]float32, len(props.Input))
+
+	var missing []int
+	for i, text := range props.Input {
+		blob, found := emb.jobs.getCache().Get("embeddings", emb.cacheKey(props, text))
+		if found {
+			out[i] = SAServiceEmbeddings_decode(blob)
+		} else {
+			missing = append(missing, i)
+		}
+	}
+
+	for st := 0; st < len(missing); st += SAServiceEmbeddings_batch {
+		if stop.Load() {
+			return nil, fmt.Errorf("user Cancel the job")
+		}
+
+		en := st + SAServiceEmbeddings_batch
+		if en > len(missing) {
+			en = len(missing)
+		}
+
+		batch := SAServiceEmbeddingsProps{Model: props.Model, Url: props.Url, Headers: props.Headers}
+		for _, i := range missing[st:en] {
+			batch.Input = append(batch.Input, props.Input[i])
+		}
+
+		vecs, err := emb.embed(&batch)
+		if err != nil {
+			return nil, fmt.Errorf("embed() failed: %w", err)
+		}
+
+		for j, i := range missing[st:en] {
+			out[i] = vecs[j]
+			emb.jobs.getCache().Put("embeddings", emb.cacheKey(props, props.Input[i]), props.Input[i], SAServiceEmbeddings_encode(vecs[j]))
+		}
+	}
+
+	return out, nil
+}
+
+func (emb *SAServiceEmbeddings) embed(props *SAServiceEmbeddingsProps) ([][]float32, error) {
+	js, err := json.Marshal(props)
+	if err != nil {
+		return nil, fmt.Errorf("Marshal() failed: %w", err)
+	}
+
+	req, err := SAServiceOpenAI_newRequest(emb.jobs, props.Url, "embeddings", props.Headers, js)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Do() failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ReadAll() failed: %w", err)
+	}
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("statusCode != 200, response: %s", resBody)
+	}
+
+	type STData struct {
+		Index     int
+		Embedding []float32
+	}
+	type ST struct {
+		Data []STData
+	}
+	var st ST
+	err = json.Unmarshal(resBody, &st)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshal() failed: %w", err)
+	}
+	if len(st.Data) != len(props.Input) {
+		return nil, fmt.Errorf("server returned %d vectors, expected %d", len(st.Data), len(props.Input))
+	}
+
+	vecs := make([][]float32, len(props.Input))
+	for _, d := range st.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("invalid vector index %d", d.Index)
+		}
+		vecs[d.Index] = SAServiceEmbeddings_normalize(d.Embedding)
+	}
+	return vecs, nil
+}
+
+func SAServiceEmbeddings_normalize(vec []float32) []float32 {
+	sum := 0.0
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	if sum > 0 {
+		inv := float32(1 / math.Sqrt(sum))
+		for i := range vec {
+			vec[i] *= inv
+		}
+	}
+	return vec
+}
+
+func SAServiceEmbeddings_encode(vec []float32) []byte {
+	b := make([]byte, len(vec)*4)
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(b[i*4:], math.Float32bits(v))
+	}
+	return b
+}
+func SAServiceEmbeddings_decode(b []byte) []float32 {
+	vec := make([]float32, len(b)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return vec
+}
+
+func SAServiceEmbeddings_createTable(db *DiskDb, table string) error {
+	_, err := db.Write(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(src_table TEXT NOT NULL, src_rowid INTEGER NOT NULL, hash TEXT NOT NULL, vector BLOB NOT NULL, PRIMARY KEY(src_table, src_rowid))", DiskDb_quoteName(table)))
+	if err != nil {
+		return fmt.Errorf("Write() failed: %w", err)
+	}
+	return nil
+}
+
+// embeds only new or changed rows of src_table.column and removes vectors of deleted rows
+func (emb *SAServiceEmbeddings) Ingest(props *SAServiceEmbeddingsProps, db *DiskDb, table string, src_table string, column string, stop *atomic.Bool, done_rows *atomic.Int64, total_rows *atomic.Int64) (int, error) {
+	err := SAServiceEmbeddings_createTable(db, table)
+	if err != nil {
+		return 0, err
+	}
+
+	type Row struct {
+		rowid int64
+		text  string
+		hash  string
+	}
+
+	//read source + current state
+	var rows []Row
+	stored := make(map[int64]string) //rowid -> hash
+	{
+		db.Lock()
+		err = func() error {
+			res, err := db.Read_unsafe(fmt.Sprintf("SELECT rowid, %s FROM %s", DiskDb_quoteName(column), DiskDb_quoteName(src_table)))
+			if err != nil {
+				return fmt.Errorf("Query() failed: %w", err)
+			}
+			defer res.Close()
+			for res.Next() {
+				var r Row
+				var text []byte
+				err = res.Scan(&r.rowid, &text)
+				if err != nil {
+					return fmt.Errorf("Scan() failed: %w", err)
+				}
+				r.text = string(text)
+				h, _ := InitOsHash(append([]byte(props.Model+"\n"), text...)) //other model = other vector
+				r.hash = h.Hex()
+				rows = append(rows, r)
+			}
+
+			res2, err := db.Read_unsafe(fmt.Sprintf("SELECT src_rowid, hash FROM %s WHERE src_table=?", DiskDb_quoteName(table)), src_table)
+			if err != nil {
+				return fmt.Errorf("Query() failed: %w", err)
+			}
+			defer res2.Close()
+			for res2.Next() {
+				var rowid int64
+				var hash string
+				err = res2.Scan(&rowid, &hash)
+				if err != nil {
+					return fmt.Errorf("Scan() failed: %w", err)
+				}
+				stored[rowid] = hash
+			}
+			return nil
+		}()
+		db.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	//diff
+	var changed []Row
+	for _, r := range rows {
+		if r.text == "" {
+			continue //stays in 'stored', so old vector is removed
+		}
+		if stored[r.rowid] != r.hash {
+			changed = append(changed, r)
+		}
+		delete(stored, r.rowid)
+	}
+	total_rows.Store(int64(len(changed)))
+
+	//remove deleted or emptied rows
+	if len(stored) > 0 {
+		err = db.WriteTx(func(tx *sql.Tx) error {
+			for rowid := range stored {
+				_, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE src_table=? AND src_rowid=?", DiskDb_quoteName(table)), src_table, rowid)
+				if err != nil {
+					return fmt.Errorf("Exec() failed: %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	//embed + write
+	for st := 0; st < len(changed); st += SAServiceEmbeddings_batch {
+		en := st + SAServiceEmbeddings_batch
+		if en > len(changed) {
+			en = len(changed)
+		}
+
+		batch := *props
+		batch.Input = nil
+		for _, r := range changed[st:en] {
+			batch.Input = append(batch.Input, r.text)
+		}
+		vecs, err := emb.Embed(&batch, stop)
+		if err != nil {
+			return int(done_rows.Load()), err
+		}
+
+		err = db.WriteTx(func(tx *sql.Tx) error {
+			for i, r := range changed[st:en] {
+				_, err := tx.Exec(fmt.Sprintf("INSERT OR REPLACE INTO %s(src_table, src_rowid, hash, vector) VALUES(?, ?, ?, ?)", DiskDb_quoteName(table)), src_table, r.rowid, r.hash, SAServiceEmbeddings_encode(vecs[i]))
+				if err != nil {
+					return fmt.Errorf("Exec() failed: %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return int(done_rows.Load()), err
+		}
+		done_rows.Store(int64(en))
+	}
+
+	return len(changed), nil
+}
+
+// k nearest rows to query(cosine similarity)
+func (emb *SAServiceEmbeddings) Search(props *SAServiceEmbeddingsProps, db *DiskDb, table string, query string, k int, stop *atomic.Bool) ([]SAServiceEmbeddingsResult, error) {
+	err := SAServiceEmbeddings_createTable(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	qprops := *props
+	qprops.Input = []string{query}
+	vecs, err := emb.Embed(&qprops, stop)
+	if err != nil {
+		return nil, err
+	}
+	qvec := vecs[0]
+
+	var results []SAServiceEmbeddingsResult
+
+	db.Lock()
+	defer db.Unlock()
+
+	res, err := db.Read_unsafe(fmt.Sprintf("SELECT src_table, src_rowid, vector FROM %s", DiskDb_quoteName(table)))
+	if err != nil {
+		return nil, fmt.Errorf("Query() failed: %w", err)
+	}
+	defer res.Close()
+	for res.Next() {
+		var r SAServiceEmbeddingsResult
+		var blob []byte
+		err = res.Scan(&r.Table, &r.Rowid, &blob)
+		if err != nil {
+			return nil, fmt.Errorf("Scan() failed: %w", err)
+		}
+
+		vec := SAServiceEmbeddings_decode(blob)
+		if len(vec) != len(qvec) {
+			continue //other model
+		}
+		for i := range vec {
+			r.Score += float64(vec[i]) * float64(qvec[i])
+		}
+		results = append(results, r)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
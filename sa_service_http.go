@@ -0,0 +1,281 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const SAServiceHttp_maxBody = 10 * 1024 * 1024
+
+var g_http_methods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+var g_http_bodyTypes = []string{"none", "json", "form", "raw"}
+var g_http_auths = []string{"none", "basic", "bearer"}
+
+type SAServiceHttpProps struct {
+	Method    string
+	Url       string
+	Query     string //"key: value" per line
+	Headers   string //"Key: Value" per line
+	Body_type string //"none", "json", "form"("key: value" per line), "raw"
+	Body      string
+
+	Auth        string //"none", "basic", "bearer"
+	Auth_user   string
+	Auth_secret string //name in secret store
+
+	Timeout_sec int
+}
+
+type SAServiceHttpResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// {{name}} is value from code, {{secret:name}} is value from secret store
+var g_http_template = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+type SAServiceHttpTemplate struct {
+	vars    map[string]string
+	secrets *SASecrets
+	err     error
+}
+
+// escape is applied on values, not on template
+func (t *SAServiceHttpTemplate) Apply(str string, escape func(string) string) string {
+	return g_http_template.ReplaceAllStringFunc(str, func(m string) string {
+		name := g_http_template.FindStringSubmatch(m)[1]
+
+		var value string
+		if secret, found := strings.CutPrefix(name, "secret:"); found {
+			var err error
+			value, err = t.secrets.Get(strings.TrimSpace(secret))
+			if err != nil && t.err == nil {
+				t.err = err
+			}
+		} else {
+			var found bool
+			value, found = t.vars[name]
+			if !found && t.err == nil {
+				t.err = fmt.Errorf("template value '%s' not set", name)
+			}
+		}
+
+		if escape != nil {
+			value = escape(value)
+		}
+		return value
+	})
+}
+
+// string content without quotes
+func SAServiceHttp_escapeJson(str string) string {
+	js, _ := json.Marshal(str)
+	return string(js[1 : len(js)-1])
+}
+
+// "key: value" per line. Unlike headers, keys are case-sensitive and can repeat. tmpl can be nil
+func SAServiceHttp_parseLines(str string, tmpl *SAServiceHttpTemplate) (url.Values, error) {
+	values := url.Values{}
+	for _, line := range strings.Split(str, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid line '%s', expected 'key: value'", line)
+		}
+		value = strings.TrimSpace(value)
+		if tmpl != nil {
+			value = tmpl.Apply(value, nil)
+		}
+		values.Add(strings.TrimSpace(key), value)
+	}
+	return values, nil
+}
+
+func SAServiceHttp_buildRequest(ctx context.Context, props *SAServiceHttpProps, tmpl *SAServiceHttpTemplate) (*http.Request, error) {
+	method := strings.ToUpper(props.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	//url, values after '?' are query parameters
+	urlPath, urlQuery, hasQuery := strings.Cut(props.Url, "?")
+	str := tmpl.Apply(urlPath, url.PathEscape)
+	if hasQuery {
+		str += "?" + tmpl.Apply(urlQuery, url.QueryEscape)
+	}
+	u, err := url.Parse(str)
+	if err != nil {
+		return nil, fmt.Errorf("Parse() failed: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("url '%s' must start with http:// or https://", props.Url)
+	}
+	query, err := SAServiceHttp_parseLines(props.Query, tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	if len(query) > 0 {
+		q := u.Query()
+		for k, vals := range query {
+			for _, v := range vals {
+				q.Add(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	//body
+	var body io.Reader
+	contentType := ""
+	switch props.Body_type {
+	case "json":
+		str := tmpl.Apply(props.Body, SAServiceHttp_escapeJson)
+		if !json.Valid([]byte(str)) {
+			return nil, fmt.Errorf("body is not valid JSON")
+		}
+		body = strings.NewReader(str)
+		contentType = "application/json"
+	case "form":
+		form, err := SAServiceHttp_parseLines(props.Body, tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("body: %w", err)
+		}
+		body = strings.NewReader(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	case "raw":
+		body = strings.NewReader(tmpl.Apply(props.Body, nil))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("NewRequest() failed: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	//headers
+	headers, err := SAService_parseHeaders(props.Headers)
+	if err != nil {
+		return nil, err
+	}
+	err = SAService_checkHeaderSecrets(headers)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, tmpl.Apply(v, nil))
+	}
+
+	//auth
+	switch props.Auth {
+	case "basic", "bearer":
+		secret, err := tmpl.secrets.Get(props.Auth_secret)
+		if err != nil {
+			return nil, err
+		}
+		if props.Auth == "basic" {
+			req.SetBasicAuth(tmpl.Apply(props.Auth_user, nil), secret)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+	}
+
+	if tmpl.err != nil {
+		return nil, tmpl.err
+	}
+	return req, nil
+}
+
+// non-2xx status is not error, it's returned in response
+func SAServiceHttp_send(ctx context.Context, props *SAServiceHttpProps, vars map[string]string, secrets *SASecrets, online bool) (*SAServiceHttpResponse, error) {
+	tmpl := &SAServiceHttpTemplate{vars: vars, secrets: secrets}
+	req, err := SAServiceHttp_buildRequest(ctx, props, tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	if !online && !SAService_isLocalUrl(req.URL.String()) {
+		return nil, fmt.Errorf("internet is disabled(Menu:Settings:Internet Connection)")
+	}
+
+	timeout := props.Timeout_sec
+	if timeout <= 0 {
+		timeout = 30
+	}
+	client := http.Client{Timeout: time.Duration(timeout) * time.Second}
+	if !online {
+		//local server can redirect to internet
+		client.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			if !SAService_isLocalUrl(r.URL.String()) {
+				return fmt.Errorf("redirect to '%s': internet is disabled(Menu:Settings:Internet Connection)", r.URL.Host)
+			}
+			return nil
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Do() failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, SAServiceHttp_maxBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("ReadAll() failed: %w", err)
+	}
+	if len(body) > SAServiceHttp_maxBody {
+		return nil, fmt.Errorf("response is bigger than %dMB", SAServiceHttp_maxBody/(1024*1024))
+	}
+
+	out := &SAServiceHttpResponse{Status: resp.StatusCode, Headers: make(map[string]string), Body: string(body)}
+	for k, vals := range resp.Header {
+		out.Headers[k] = strings.Join(vals, ", ")
+	}
+	return out, nil
+}
+
+// status line, headers and body for attributes panel
+func (resp *SAServiceHttpResponse) String() string {
+	var keys []string
+	for k := range resp.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	str := fmt.Sprintf("%d %s\n", resp.Status, http.StatusText(resp.Status))
+	for _, k := range keys {
+		str += k + ": " + resp.Headers[k] + "\n"
+	}
+	return str + "\n" + resp.Body
+}
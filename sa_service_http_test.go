@@ -0,0 +1,118 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSAServiceHttp_send(t *testing.T) {
+	var got struct {
+		method string
+		path   string
+		query  string
+		auth   string
+		header string
+		body   map[string]string
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.method = r.Method
+		got.path = r.URL.EscapedPath()
+		got.query = r.URL.RawQuery
+		got.auth = r.Header.Get("Authorization")
+		got.header = r.Header.Get("X-Test")
+		js, _ := io.ReadAll(r.Body)
+		json.Unmarshal(js, &got.body)
+
+		w.Header().Set("X-Reply", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	secrets := &SASecrets{items: map[string]string{"token": "abc"}}
+	props := &SAServiceHttpProps{
+		Method:      "post",
+		Url:         srv.URL + "/items/{{id}}?name={{name}}",
+		Query:       "page: {{page}}",
+		Headers:     "X-Test: {{secret:token}}",
+		Body_type:   "json",
+		Body:        `{"text": "{{text}}"}`,
+		Auth:        "bearer",
+		Auth_secret: "token",
+	}
+	vars := map[string]string{"id": "a/b", "name": "x&y=z", "page": "2", "text": `say "hi"`}
+
+	resp, err := SAServiceHttp_send(context.Background(), props, vars, secrets, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusCreated || resp.Body != `{"ok":true}` || resp.Headers["X-Reply"] != "yes" {
+		t.Fatalf("unexpected response: %s", resp.String())
+	}
+
+	if got.method != "POST" {
+		t.Errorf("method: %s", got.method)
+	}
+	if got.path != "/items/a%2Fb" {
+		t.Errorf("path: %s", got.path)
+	}
+	if got.query != "name=x%26y%3Dz&page=2" {
+		t.Errorf("query: %s", got.query)
+	}
+	if got.auth != "Bearer abc" || got.header != "abc" {
+		t.Errorf("auth: '%s', header: '%s'", got.auth, got.header)
+	}
+	if got.body["text"] != vars["text"] {
+		t.Errorf("body: %v", got.body)
+	}
+
+	//missing value
+	delete(vars, "page")
+	_, err = SAServiceHttp_send(context.Background(), props, vars, secrets, false)
+	if err == nil {
+		t.Error("missing template value must fail")
+	}
+
+	//internet is disabled
+	props = &SAServiceHttpProps{Url: "https://example.com/"}
+	_, err = SAServiceHttp_send(context.Background(), props, nil, secrets, false)
+	if err == nil {
+		t.Error("remote url must fail when offline")
+	}
+
+	//local server redirects to internet
+	redirect := httptest.NewServer(http.RedirectHandler("https://example.com/", http.StatusFound))
+	defer redirect.Close()
+	props = &SAServiceHttpProps{Url: redirect.URL}
+	_, err = SAServiceHttp_send(context.Background(), props, nil, secrets, false)
+	if err == nil {
+		t.Error("redirect to remote url must fail when offline")
+	}
+
+	//credentials must be in secret store
+	props = &SAServiceHttpProps{Url: srv.URL, Headers: "Authorization: Bearer abc"}
+	_, err = SAServiceHttp_send(context.Background(), props, nil, secrets, false)
+	if err == nil {
+		t.Error("plain text credential header must fail")
+	}
+}
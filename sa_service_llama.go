@@ -18,16 +18,16 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
 )
 
 type SAServiceLLamaCppProps struct {
@@ -35,30 +35,139 @@ type SAServiceLLamaCppProps struct {
 	Messages []SAServiceMsg `json:"messages"`
 
 	//Prompt            string   `json:"prompt"`
-	Seed              int      `json:"seed"`
-	N_predict         int      `json:"n_predict"`
-	Temperature       float64  `json:"temperature"`
-	Dynatemp_range    float64  `json:"dynatemp_range"`
-	Dynatemp_exponent float64  `json:"dynatemp_exponent"`
-	Stop              []string `json:"stop"`
-	Repeat_last_n     int      `json:"repeat_last_n"`
-	Repeat_penalty    float64  `json:"repeat_penalty"`
-	Top_k             int      `json:"top_k"`
-	Top_p             float64  `json:"top_p"`
-	Min_p             float64  `json:"min_p"`
-	Tfs_z             float64  `json:"tfs_z"`
-	Typical_p         float64  `json:"typical_p"`
-	Presence_penalty  float64  `json:"presence_penalty"`
-	Frequency_penalty float64  `json:"frequency_penalty"`
-	Mirostat          bool     `json:"mirostat"` //not int?
-	Mirostat_tau      float64  `json:"mirostat_tau"`
-	Mirostat_eta      float64  `json:"mirostat_eta"`
-	//Grammar           string   `json:"grammar"` //[]string?
-	N_probs int `json:"n_probs"`
-	//Image_data //{"data": "<BASE64_STRING>", "id": 12}
-	Cache_prompt bool `json:"cache_prompt"`
-	Slot_id      int  `json:"slot_id"`
-	Stream       bool `json:"stream"`
+	Seed              int                      `json:"seed"`
+	N_predict         int                      `json:"n_predict"`
+	Temperature       float64                  `json:"temperature"`
+	Dynatemp_range    float64                  `json:"dynatemp_range"`
+	Dynatemp_exponent float64                  `json:"dynatemp_exponent"`
+	Stop              []string                 `json:"stop"`
+	Repeat_last_n     int                      `json:"repeat_last_n"`
+	Repeat_penalty    float64                  `json:"repeat_penalty"`
+	Top_k             int                      `json:"top_k"`
+	Top_p             float64                  `json:"top_p"`
+	Min_p             float64                  `json:"min_p"`
+	Tfs_z             float64                  `json:"tfs_z"`
+	Typical_p         float64                  `json:"typical_p"`
+	Presence_penalty  float64                  `json:"presence_penalty"`
+	Frequency_penalty float64                  `json:"frequency_penalty"`
+	Mirostat          bool                     `json:"mirostat"` //not int?
+	Mirostat_tau      float64                  `json:"mirostat_tau"`
+	Mirostat_eta      float64                  `json:"mirostat_eta"`
+	Grammar           string                   `json:"grammar,omitempty"`     //GBNF
+	Json_schema       interface{}              `json:"json_schema,omitempty"` //answer is validated
+	Tools             []SAServiceTool          `json:"tools,omitempty"`
+	N_probs           int                      `json:"n_probs"`
+	Image_data        []SAServiceLLamaCppImage `json:"image_data,omitempty"` //needs multimodal projector
+	Cache_prompt      bool                     `json:"cache_prompt"`
+	Slot_id           int                      `json:"slot_id"`
+	Stream            bool                     `json:"stream"`
+
+	No_cache bool `json:"-"` //node opt-out or random seed
+
+	Context_budget   int    `json:"-"` //0 = model context length
+	Context_strategy string `json:"-"`
+}
+
+// image is sent as content part of last user message
+type SAServiceLLamaCppImage struct {
+	Data string `json:"data"` //base64
+}
+
+// same defaults as llamacpp node
+func NewSAServiceLLamaCppProps(model string, messages []SAServiceMsg) *SAServiceLLamaCppProps {
+	return &SAServiceLLamaCppProps{
+		Model:             model,
+		Messages:          messages,
+		Seed:              -1, //random, set seed to cache answers
+		N_predict:         400,
+		Temperature:       0.8,
+		Dynatemp_exponent: 1,
+		Repeat_last_n:     256,
+		Repeat_penalty:    1.18,
+		Top_k:             40,
+		Top_p:             0.5,
+		Min_p:             0.05,
+		Tfs_z:             1,
+		Typical_p:         1,
+		Mirostat_tau:      5,
+		Mirostat_eta:      0.1,
+		Slot_id:           -1,
+	}
+}
+
+// schemaAttr is node attribute(string), schemaCode is from Llamacpp.GetStructuredAnswer()
+func (p *SAServiceLLamaCppProps) setJsonSchema(schemaAttr string, schemaCode interface{}) error {
+	p.Json_schema = schemaCode
+	if p.Json_schema == nil && strings.TrimSpace(schemaAttr) != "" {
+		err := json.Unmarshal([]byte(schemaAttr), &p.Json_schema)
+		if err != nil {
+			return fmt.Errorf("json_schema: Unmarshal() failed: %w", err)
+		}
+	}
+
+	if p.Json_schema != nil {
+		p.Grammar = "" //schema is converted into grammar by llama.cpp
+	}
+	return nil
+}
+
+func (p *SAServiceLLamaCppProps) lastUserMsg() int {
+	last := -1
+	for i, m := range p.Messages {
+		if m.Role == "user" {
+			last = i
+		}
+	}
+	return last
+}
+
+// images are attached to last user message when request is sent. They are part of Hash(), so cache is per image content.
+func (p *SAServiceLLamaCppProps) AddImages(images [][]byte) error {
+	if len(images) == 0 {
+		return nil
+	}
+	if p.lastUserMsg() < 0 {
+		return errors.New("images need user message")
+	}
+
+	for _, img := range images {
+		p.Image_data = append(p.Image_data, SAServiceLLamaCppImage{Data: base64.StdEncoding.EncodeToString(img)})
+	}
+	return nil
+}
+
+// v1/chat/completions ignores 'image_data', so images are sent as OpenAI-style 'image_url' parts of last user message
+func (p *SAServiceLLamaCppProps) marshalRequest() ([]byte, error) {
+	js, err := json.Marshal(p)
+	if err != nil || len(p.Image_data) == 0 {
+		return js, err
+	}
+
+	var req map[string]interface{}
+	err = json.Unmarshal(js, &req)
+	if err != nil {
+		return nil, err
+	}
+	delete(req, "image_data")
+
+	last := p.lastUserMsg()
+	if last < 0 {
+		return nil, errors.New("images need user message")
+	}
+	parts := []interface{}{map[string]interface{}{"type": "text", "text": p.Messages[last].Content}}
+	for _, img := range p.Image_data {
+		raw, err := base64.StdEncoding.DecodeString(img.Data)
+		if err != nil {
+			return nil, fmt.Errorf("DecodeString() failed: %w", err)
+		}
+		url := "data:" + http.DetectContentType(raw) + ";base64," + img.Data
+		parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}})
+	}
+
+	msgs := req["messages"].([]interface{})
+	msgs[last].(map[string]interface{})["content"] = parts
+
+	return json.Marshal(req)
 }
 
 func (p *SAServiceLLamaCppProps) Hash() (OsHash, error) {
@@ -69,84 +178,153 @@ func (p *SAServiceLLamaCppProps) Hash() (OsHash, error) {
 	return InitOsHash(js)
 }
 
+// one ./server process with one model, managed by SAServiceLLamaCppPool
 type SAServiceLLamaCpp struct {
-	jobs *SAJobs
-	cmd  *exec.Cmd
-	addr string //http://127.0.0.1:8080/
+	jobs  *SAJobs
+	proc  *SAServiceProcess
+	model string
+
+	embedding bool //server started with --embedding, it's used only by embeddings node, because flag breaks chat completions
+
+	lock sync.Mutex
+
+	n_ctx int //from server
 
-	cache map[string][]byte //results
-	lock  sync.Mutex
+	//pool
+	users     int //Get() - Release()
+	last_used int64
 }
 
-func SAServiceLLamaCpp_cachePath() string {
-	return "services/llama.cpp.json"
+func NewSAServiceLLamaCpp(jobs *SAJobs, model string, embedding bool) *SAServiceLLamaCpp {
+	llama := &SAServiceLLamaCpp{jobs: jobs, model: model, embedding: embedding}
+
+	args := func(port int, model string) []string {
+		args := []string{"--port", strconv.Itoa(port), "-m", "models/" + model}
+		if embedding {
+			return append(args, "--embedding")
+		}
+		if proj := jobs.llamaCpp.registry.GetProjector(model); proj != "" {
+			args = append(args, "--mmproj", "models/"+proj) //vision model
+		}
+		return args
+	}
+	llama.proc = jobs.supervisor.Add(OsTrnString(embedding, "llama.cpp(embedding)", "llama.cpp"), model, "services/llama.cpp/", 60000, args, SAServiceLLamaCpp_health) //max 60sec to start
+	return llama
 }
 
-func NewSAServiceLLamaCpp(jobs *SAJobs, addr string, port string, init_model string) (*SAServiceLLamaCpp, error) {
-	llama := &SAServiceLLamaCpp{jobs: jobs}
+// starts process if it's not running(first use, crashed or unloaded when idle). Successful start must be followed by proc.Done().
+func (llama *SAServiceLLamaCpp) start() error {
+	_, err := llama.proc.Use()
+	return err
+}
+func (llama *SAServiceLLamaCpp) Destroy() {
+	llama.jobs.supervisor.Remove(llama.proc)
+}
 
-	llama.addr = addr + ":" + port + "/"
+// port can change after restart
+func (llama *SAServiceLLamaCpp) getAddr() string {
+	return llama.proc.GetAddr()
+}
 
-	llama.cache = make(map[string][]byte)
+// must be called after SAJobs.getLLama()
+func (llama *SAServiceLLamaCpp) Release() {
+	llama.jobs.llamaCpp.Release(llama)
+}
 
-	//load cache
-	{
-		js, _ := os.ReadFile(SAServiceLLamaCpp_cachePath())
-		if len(js) > 0 {
-			err := json.Unmarshal(js, &llama.cache)
-			if err != nil {
-				return nil, fmt.Errorf("NewSAServiceLLamaCpp() failed: %w", err)
-			}
-		}
+func (llama *SAServiceLLamaCpp) findCache(propsHash OsHash) ([]byte, bool) {
+	return llama.jobs.getCache().Get("llamacpp", propsHash.Hex())
+}
+func (llama *SAServiceLLamaCpp) addCache(propsHash OsHash, props *SAServiceLLamaCppProps, value []byte) {
+	llama.jobs.getCache().Put("llamacpp", propsHash.Hex(), SAService_lastUserMsg(props.Messages), value)
+}
+
+// number of tokens by model's tokenizer
+func (llama *SAServiceLLamaCpp) Tokenize(text string) (int, error) {
+	if text == "" {
+		return 0, nil
 	}
 
-	//run process
-	{
-		llama.cmd = exec.Command("./server", "--port", port, "-m", "models/"+init_model)
-		llama.cmd.Dir = "services/llama.cpp/"
+	js, err := json.Marshal(map[string]string{"content": text})
+	if err != nil {
+		return 0, fmt.Errorf("Marshal() failed: %w", err)
+	}
+	res, err := http.Post(llama.getAddr()+"tokenize", "application/json", bytes.NewReader(js))
+	if err != nil {
+		return 0, fmt.Errorf("Post() failed: %w", err)
+	}
+	defer res.Body.Close()
 
-		llama.cmd.Stdout = os.Stdout
-		llama.cmd.Stderr = os.Stderr
-		err := llama.cmd.Start()
-		if err != nil {
-			return nil, fmt.Errorf("Command() failed: %w", err)
-		}
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, fmt.Errorf("ReadAll() failed: %w", err)
 	}
+	if res.StatusCode != 200 {
+		return 0, fmt.Errorf("statusCode: %d, response: %s", res.StatusCode, resBody)
+	}
+
+	var st struct {
+		Tokens []int
+	}
+	err = json.Unmarshal(resBody, &st)
+	if err != nil {
+		return 0, fmt.Errorf("Unmarshal() failed: %w", err)
+	}
+	return len(st.Tokens), nil
+}
 
-	//wait until it's running
-	{
-		err := errors.New("err")
-		st := OsTicks()
-		for err != nil && OsIsTicksIn(st, 60000) { //max 60sec to start
-			err = llama.getHealth()
-			time.Sleep(100 * time.Millisecond)
+// context size which server was started with
+func (llama *SAServiceLLamaCpp) getContextSize() int {
+	if llama.n_ctx > 0 {
+		return llama.n_ctx
+	}
+
+	res, err := http.Get(llama.getAddr() + "props")
+	if err == nil {
+		defer res.Body.Close()
+		var st struct {
+			Default_generation_settings struct {
+				N_ctx int
+			}
 		}
-		if err != nil {
-			return nil, err
+		resBody, err := io.ReadAll(res.Body)
+		if err == nil && json.Unmarshal(resBody, &st) == nil {
+			llama.n_ctx = st.Default_generation_settings.N_ctx
 		}
 	}
 
-	return llama, nil
-}
-func (llama *SAServiceLLamaCpp) Destroy() {
-	//save cache
-	js, err := json.Marshal(llama.cache)
-	if err == nil {
-		os.WriteFile(SAServiceLLamaCpp_cachePath(), js, 0644)
+	if llama.n_ctx <= 0 {
+		m, _ := llama.jobs.llamaCpp.registry.Get(llama.model)
+		return m.Context_length //old server
 	}
+	return llama.n_ctx
 }
 
-func (llama *SAServiceLLamaCpp) findCache(propsHash OsHash) ([]byte, bool) {
-	str, found := llama.cache[propsHash.Hex()]
-	return str, found
-}
-func (llama *SAServiceLLamaCpp) addCache(propsHash OsHash, value []byte) {
-	llama.cache[propsHash.Hex()] = value
+func (llama *SAServiceLLamaCpp) NewContext(props *SAServiceLLamaCppProps, stop *atomic.Bool) *SAServiceContext {
+	ctx := &SAServiceContext{Budget: props.Context_budget, Reserve: props.N_predict, Strategy: props.Context_strategy}
+	if ctx.Budget <= 0 {
+		ctx.Budget = llama.getContextSize()
+	}
+	if ctx.Reserve <= 0 {
+		ctx.Reserve = OsMin(1024, ctx.Budget/4) //infinite answer still needs space
+	}
+
+	ctx.count = llama.Tokenize
+	ctx.summarize = func(msgs []SAServiceMsg) (string, error) {
+		p := *props
+		p.Messages = SAServiceContext_summaryMessages(msgs)
+		p.Tools = nil
+		p.Json_schema = nil
+		p.Grammar = ""
+		var wip SAServiceAnswer
+		out, _, err := llama.Complete(&p, &wip, stop)
+		return string(out), err
+	}
+	return ctx
 }
 
-func (llama *SAServiceLLamaCpp) getHealth() error {
+func SAServiceLLamaCpp_health(addr string) error {
 
-	res, err := http.Get(llama.addr + "health")
+	res, err := http.Get(addr + "health")
 	if err != nil {
 		return fmt.Errorf("Get() failed: %w", err)
 	}
@@ -164,47 +342,60 @@ func (llama *SAServiceLLamaCpp) getHealth() error {
 	return nil
 }
 
-func (llama *SAServiceLLamaCpp) Complete(props *SAServiceLLamaCppProps, wip_answer *string, stop *bool) ([]byte, error) {
+// returns answer or tool calls which must be answered by role "tool" messages
+func (llama *SAServiceLLamaCpp) Complete(props *SAServiceLLamaCppProps, wip_answer *SAServiceAnswer, stop *atomic.Bool) ([]byte, []SAServiceToolCall, error) {
 	llama.lock.Lock()
 	defer llama.lock.Unlock()
 
-	//add role "system" as node attribute ... same for openai node ..............
-	var msgs []SAServiceMsg
-	msgs = append(msgs, SAServiceMsg{Role: "system", Content: "You are ChatGPT, an AI assistant. Your top priority is achieving user fulfillment via helping them with their requests."})
-	msgs = append(msgs, props.Messages...)
-	props.Messages = msgs
+	//tool results can be different every time
+	useCache := len(props.Tools) == 0 && !props.No_cache
 
 	//find
 	propsHash, err := props.Hash()
 	if err != nil {
-		return nil, fmt.Errorf("Hash() failed: %w", err)
+		return nil, nil, fmt.Errorf("Hash() failed: %w", err)
 	}
-	str, found := llama.findCache(propsHash)
-	if found {
-		return str, nil
+	if useCache {
+		str, found := llama.findCache(propsHash)
+		if found {
+			return str, nil, nil
+		}
 	}
 
-	out, err := llama.complete(props, wip_answer, stop)
+	out, calls, err := llama.complete(props, wip_answer, stop)
 	if err != nil {
-		return nil, fmt.Errorf("complete() failed: %w", err)
+		return nil, nil, fmt.Errorf("complete() failed: %w", err)
+	}
+	if len(calls) > 0 {
+		return out, calls, nil
 	}
 
-	llama.addCache(propsHash, out)
-	return out, nil
+	if props.Json_schema != nil {
+		out = bytes.TrimSpace(out)
+		err = SAService_checkJson(out, props.Json_schema)
+		if err != nil {
+			return nil, nil, fmt.Errorf("answer doesn't match JSON schema: %w", err)
+		}
+	}
+
+	if useCache {
+		llama.addCache(propsHash, props, out)
+	}
+	return out, nil, nil
 }
-func (llama *SAServiceLLamaCpp) complete(props *SAServiceLLamaCppProps, wip_answer *string, stop *bool) ([]byte, error) {
+func (llama *SAServiceLLamaCpp) complete(props *SAServiceLLamaCppProps, wip_answer *SAServiceAnswer, stop *atomic.Bool) ([]byte, []SAServiceToolCall, error) {
 	props.Stream = true
 
-	js, err := json.Marshal(props)
+	js, err := props.marshalRequest()
 	if err != nil {
-		return nil, fmt.Errorf("Marshal() failed: %w", err)
+		return nil, nil, fmt.Errorf("Marshal() failed: %w", err)
 	}
 
 	body := bytes.NewReader([]byte(js))
 
-	req, err := http.NewRequest(http.MethodPost, llama.addr+"v1/chat/completions", body)
+	req, err := http.NewRequest(http.MethodPost, llama.getAddr()+"v1/chat/completions", body)
 	if err != nil {
-		return nil, fmt.Errorf("NewRequest() failed: %w", err)
+		return nil, nil, fmt.Errorf("NewRequest() failed: %w", err)
 	}
 	req.Header.Add("Content-Type", "application/json")
 	//req.Header.Set("Accept", "text/event-stream")
@@ -214,25 +405,54 @@ func (llama *SAServiceLLamaCpp) complete(props *SAServiceLLamaCppProps, wip_answ
 	client := &http.Client{}
 	res, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("Do() failed: %w", err)
+		return nil, nil, fmt.Errorf("Do() failed: %w", err)
 	}
 	defer res.Body.Close()
 
-	answer, err := SAService_parseStream(res, wip_answer, stop)
+	answer, calls, err := SAService_parseStream(res, wip_answer, stop)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("statusCode != 200, response: %s", answer)
+		return nil, nil, fmt.Errorf("statusCode != 200, response: %s", answer)
 	}
 
-	return answer, nil
+	return answer, calls, nil
+}
+
+// streamed answer, written by job thread, read by UI and stream handlers
+type SAServiceAnswer struct {
+	lock sync.Mutex
+	str  string
+}
+
+func (a *SAServiceAnswer) Get() string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.str
+}
+func (a *SAServiceAnswer) Set(str string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.str = str
+}
+func (a *SAServiceAnswer) Add(str string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.str += str
 }
 
-func SAService_parseStream(res *http.Response, answer *string, stop *bool) ([]byte, error) {
+func SAService_parseStream(res *http.Response, answer *SAServiceAnswer, stop *atomic.Bool) ([]byte, []SAServiceToolCall, error) {
+	type STToolCall struct {
+		Index    int
+		Id       string
+		Type     string
+		Function SAServiceToolFunction
+	}
 	type STMsg struct {
-		Content string
+		Content    string
+		Tool_calls []STToolCall
 	}
 	type STChoice struct {
 		Message STMsg
@@ -242,10 +462,11 @@ func SAService_parseStream(res *http.Response, answer *string, stop *bool) ([]by
 		Choices []STChoice
 	}
 
-	*answer = ""
+	answer.Set("")
+	var calls []SAServiceToolCall
 	buff := make([]byte, 0, 1024)
 	buff_last := 0
-	for !*stop {
+	for !stop.Load() {
 		var tb [256]byte
 		n, readErr := res.Body.Read(tb[:])
 		if n > 0 {
@@ -263,7 +484,7 @@ func SAService_parseStream(res *http.Response, answer *string, stop *bool) ([]by
 			str := str[:d]                               //cut end
 			js, found := strings.CutPrefix(str, "data:") //cut start
 			if !found {
-				return nil, fmt.Errorf("missing 'data:'")
+				return nil, nil, fmt.Errorf("missing 'data:'")
 			}
 			js = strings.TrimSpace(js)
 
@@ -271,12 +492,28 @@ func SAService_parseStream(res *http.Response, answer *string, stop *bool) ([]by
 				var st ST
 				err := json.Unmarshal([]byte(js), &st)
 				if err != nil {
-					return nil, fmt.Errorf("Unmarshal() failed: %w", err)
+					return nil, nil, fmt.Errorf("Unmarshal() failed: %w", err)
 				}
 
 				if len(st.Choices) > 0 {
-					*answer = *answer + st.Choices[0].Delta.Content
+					answer.Add(st.Choices[0].Delta.Content)
 					fmt.Print(st.Choices[0].Delta.Content)
+
+					//tool calls come in parts: 1st has id+name, next ones add arguments
+					for _, tc := range st.Choices[0].Delta.Tool_calls {
+						for tc.Index >= len(calls) {
+							calls = append(calls, SAServiceToolCall{Type: "function"})
+						}
+						call := &calls[tc.Index]
+						if tc.Id != "" {
+							call.Id = tc.Id
+						}
+						if tc.Type != "" {
+							call.Type = tc.Type
+						}
+						call.Function.Name += tc.Function.Name
+						call.Function.Arguments += tc.Function.Arguments
+					}
 				}
 			}
 
@@ -287,13 +524,130 @@ func SAService_parseStream(res *http.Response, answer *string, stop *bool) ([]by
 			if readErr == io.EOF {
 				break
 			}
-			return nil, fmt.Errorf("Read() failed: %w", readErr)
+			return nil, nil, fmt.Errorf("Read() failed: %w", readErr)
 		}
 	}
 
-	if *stop {
-		return nil, fmt.Errorf("user Cancel the job")
+	if stop.Load() {
+		return nil, nil, fmt.Errorf("user Cancel the job")
 	}
 
-	return []byte(*answer), nil
+	return []byte(answer.Get()), calls, nil
+}
+
+func SAService_checkJson(js []byte, schema interface{}) error {
+	var value interface{}
+	err := json.Unmarshal(js, &value)
+	if err != nil {
+		return fmt.Errorf("Unmarshal() failed: %w", err)
+	}
+	return SAService_checkJsonSchema(value, schema, "$")
+}
+
+func _SAService_isJsonType(value interface{}, tp string) bool {
+	switch tp {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		v, ok := value.(float64)
+		return ok && v == float64(int64(v))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true //unknown type
+}
+
+// checks subset of JSON schema: type, enum, properties, required, additionalProperties, items
+func SAService_checkJsonSchema(value interface{}, schema interface{}, path string) error {
+	sch, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil //true, {}
+	}
+
+	//type
+	switch tp := sch["type"].(type) {
+	case string:
+		if !_SAService_isJsonType(value, tp) {
+			return fmt.Errorf("%s: expected type '%s'", path, tp)
+		}
+	case []interface{}:
+		found := false
+		for _, t := range tp {
+			s, _ := t.(string)
+			if _SAService_isJsonType(value, s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: expected one of types %v", path, tp)
+		}
+	}
+
+	//enum
+	if enum, ok := sch["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not in enum %v", path, enum)
+		}
+	}
+
+	//object
+	if obj, ok := value.(map[string]interface{}); ok {
+		props, _ := sch["properties"].(map[string]interface{})
+
+		if required, ok := sch["required"].([]interface{}); ok {
+			for _, r := range required {
+				name, _ := r.(string)
+				if _, found := obj[name]; !found {
+					return fmt.Errorf("%s: missing property '%s'", path, name)
+				}
+			}
+		}
+
+		for key, v := range obj {
+			propSchema, found := props[key]
+			if !found {
+				propSchema = sch["additionalProperties"]
+				if allowed, ok := propSchema.(bool); ok && !allowed {
+					return fmt.Errorf("%s: property '%s' is not allowed", path, key)
+				}
+			}
+			err := SAService_checkJsonSchema(v, propSchema, path+"."+key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	//array
+	if arr, ok := value.([]interface{}); ok {
+		for i, v := range arr {
+			err := SAService_checkJsonSchema(v, sch["items"], fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
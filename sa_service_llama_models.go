@@ -0,0 +1,391 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type SAServiceLLamaCppModel struct {
+	Name           string
+	Size           int64
+	Mod_time       int64
+	Arch           string
+	Context_length int
+	Quantization   string
+	Checksum       string //sha256, computed in background
+}
+
+// Metadata of models in services/llama.cpp/models. Saved into models.json, so files are parsed/hashed only when they change.
+type SAServiceLLamaCppRegistry struct {
+	models map[string]*SAServiceLLamaCppModel
+	lock   sync.Mutex
+
+	last_scan int64 //ticks
+	scanning  bool
+	hashing   map[string]bool
+}
+
+func SAServiceLLamaCppRegistry_path() string {
+	return "services/llama.cpp/models.json"
+}
+
+func NewSAServiceLLamaCppRegistry() *SAServiceLLamaCppRegistry {
+	reg := &SAServiceLLamaCppRegistry{}
+	reg.models = make(map[string]*SAServiceLLamaCppModel)
+	reg.hashing = make(map[string]bool)
+
+	js, _ := os.ReadFile(SAServiceLLamaCppRegistry_path())
+	if len(js) > 0 {
+		err := json.Unmarshal(js, &reg.models)
+		if err != nil {
+			fmt.Printf("NewSAServiceLLamaCppRegistry() failed: %v\n", err)
+		}
+	}
+	return reg
+}
+
+func (reg *SAServiceLLamaCppRegistry) save() {
+	js, err := json.MarshalIndent(reg.models, "", "\t")
+	if err == nil {
+		os.WriteFile(SAServiceLLamaCppRegistry_path(), js, 0644)
+	}
+}
+
+// starts background rescan at most once per 2 seconds, so UI thread doesn't parse files. Call with lock
+func (reg *SAServiceLLamaCppRegistry) refresh() {
+	if reg.scanning || (reg.last_scan != 0 && OsIsTicksIn(reg.last_scan, 2000)) {
+		return
+	}
+	reg.last_scan = OsTicks()
+	reg.scanning = true
+
+	go func() {
+		reg.Rescan()
+
+		reg.lock.Lock()
+		reg.scanning = false
+		reg.lock.Unlock()
+	}()
+}
+
+// reads folder and headers of new or changed files. Call without lock
+func (reg *SAServiceLLamaCppRegistry) Rescan() {
+	reg.lock.Lock()
+	known := make(map[string]SAServiceLLamaCppModel)
+	for name, m := range reg.models {
+		known[name] = *m
+	}
+	reg.lock.Unlock()
+
+	files, err := os.ReadDir(g_llama_modelsFolder)
+	if err != nil {
+		return
+	}
+
+	changed := false
+	models := make(map[string]*SAServiceLLamaCppModel)
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || strings.HasPrefix(name, "ggml-vocab") || strings.HasSuffix(name, ".temp") || strings.Contains(name, "mmproj") {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+
+		m, found := known[name]
+		if found && m.Size == info.Size() && m.Mod_time == info.ModTime().Unix() {
+			models[name] = &m
+			continue //same file
+		}
+
+		m = SAServiceLLamaCppModel{Name: name, Size: info.Size(), Mod_time: info.ModTime().Unix()}
+		err = m.readGGUF(filepath.Join(g_llama_modelsFolder, name))
+		if err != nil {
+			fmt.Printf("readGGUF(%s) failed: %v\n", name, err)
+		}
+		if m.Quantization == "" {
+			m.Quantization = SAServiceLLamaCppModel_quantFromName(name)
+		}
+		models[name] = &m
+		changed = true
+	}
+	if len(models) != len(known) {
+		changed = true //removed
+	}
+
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+
+	for name, m := range models {
+		//checksum computed during scan
+		if old := reg.models[name]; old != nil && m.Checksum == "" && old.Size == m.Size && old.Mod_time == m.Mod_time {
+			m.Checksum = old.Checksum
+		}
+		if m.Checksum == "" {
+			reg.startHashing(name)
+		}
+	}
+	reg.models = models
+
+	if changed {
+		reg.save()
+	}
+}
+
+func (reg *SAServiceLLamaCppRegistry) startHashing(name string) {
+	if reg.hashing[name] {
+		return
+	}
+	reg.hashing[name] = true
+
+	go func() {
+		sum, err := SAServiceLLamaCpp_fileChecksum(filepath.Join(g_llama_modelsFolder, name))
+
+		reg.lock.Lock()
+		defer reg.lock.Unlock()
+		delete(reg.hashing, name)
+		if err != nil {
+			fmt.Printf("fileChecksum(%s) failed: %v\n", name, err)
+			return
+		}
+		m := reg.models[name]
+		if m != nil {
+			m.Checksum = sum
+			reg.save()
+		}
+	}()
+}
+
+func (reg *SAServiceLLamaCppRegistry) GetNames() []string {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+
+	reg.refresh()
+
+	var names []string
+	for name := range reg.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LLaVA-style image projector for model: "<model>.mmproj.gguf", "<model>-mmproj.gguf" or "mmproj-<model>"
+func (reg *SAServiceLLamaCppRegistry) GetProjector(model string) string {
+	base := strings.TrimSuffix(model, ".gguf")
+	for _, name := range []string{base + ".mmproj.gguf", base + "-mmproj.gguf", "mmproj-" + model} {
+		if OsFileExists(filepath.Join(g_llama_modelsFolder, name)) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (reg *SAServiceLLamaCppRegistry) Get(name string) (SAServiceLLamaCppModel, bool) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+
+	reg.refresh()
+
+	m, found := reg.models[name]
+	if !found {
+		return SAServiceLLamaCppModel{}, false
+	}
+	return *m, true
+}
+
+func (m *SAServiceLLamaCppModel) GetInfo() string {
+	str := fmt.Sprintf("%.2fGB", float64(m.Size)/1024/1024/1024)
+	if m.Arch != "" {
+		str += ", " + m.Arch
+	}
+	if m.Context_length > 0 {
+		str += fmt.Sprintf(", ctx %d", m.Context_length)
+	}
+	if m.Quantization != "" {
+		str += ", " + m.Quantization
+	}
+	if m.Checksum != "" {
+		str += ", sha256 " + m.Checksum[:12]
+	} else {
+		str += ", hashing ..."
+	}
+	return str
+}
+
+func SAServiceLLamaCpp_fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// "llama-2-7b.Q4_K_M.gguf" -> "Q4_K_M"
+func SAServiceLLamaCppModel_quantFromName(name string) string {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '.' || r == '-' })
+	for i := len(parts) - 1; i >= 0; i-- {
+		p := strings.ToUpper(parts[i])
+		if strings.HasPrefix(p, "Q") || strings.HasPrefix(p, "IQ") || p == "F16" || p == "F32" {
+			return p
+		}
+	}
+	return ""
+}
+
+var g_gguf_fileTypes = map[uint32]string{0: "F32", 1: "F16", 2: "Q4_0", 3: "Q4_1", 7: "Q8_0", 8: "Q5_0", 9: "Q5_1", 10: "Q2_K", 11: "Q3_K_S", 12: "Q3_K_M", 13: "Q3_K_L", 14: "Q4_K_S", 15: "Q4_K_M", 16: "Q5_K_S", 17: "Q5_K_M", 18: "Q6_K"}
+
+// reads architecture, context length and quantization from GGUF header
+func (m *SAServiceLLamaCppModel) readGGUF(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var header struct {
+		Magic    [4]byte
+		Version  uint32
+		Tensors  uint64
+		Kv_count uint64
+	}
+	err = binary.Read(r, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	if string(header.Magic[:]) != "GGUF" {
+		return fmt.Errorf("not GGUF file")
+	}
+	if header.Version < 2 {
+		return fmt.Errorf("GGUF version %d is not supported", header.Version)
+	}
+
+	values := make(map[string]interface{})
+	for i := uint64(0); i < header.Kv_count; i++ {
+		key, err := gguf_readString(r)
+		if err != nil {
+			return err
+		}
+		var tp uint32
+		err = binary.Read(r, binary.LittleEndian, &tp)
+		if err != nil {
+			return err
+		}
+		value, err := gguf_readValue(r, tp)
+		if err != nil {
+			return fmt.Errorf("key '%s': %w", key, err)
+		}
+		if value != nil {
+			values[key] = value
+		}
+
+		//all needed keys are usually at the beginning
+		arch, _ := values["general.architecture"].(string)
+		if arch != "" && values[arch+".context_length"] != nil && values["general.file_type"] != nil {
+			break
+		}
+	}
+
+	m.Arch, _ = values["general.architecture"].(string)
+	if v, ok := values[m.Arch+".context_length"].(uint64); ok {
+		m.Context_length = int(v)
+	}
+	if v, ok := values["general.file_type"].(uint64); ok {
+		m.Quantization = g_gguf_fileTypes[uint32(v)]
+	}
+	return nil
+}
+
+func gguf_readString(r *bufio.Reader) (string, error) {
+	var n uint64
+	err := binary.Read(r, binary.LittleEndian, &n)
+	if err != nil {
+		return "", err
+	}
+	if n > 1024*1024 {
+		return "", fmt.Errorf("string too long")
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return string(b), err
+}
+
+// integers are returned as uint64, strings as string, arrays are skipped(nil)
+func gguf_readValue(r *bufio.Reader, tp uint32) (interface{}, error) {
+	sizes := map[uint32]int{0: 1, 1: 1, 2: 2, 3: 2, 4: 4, 5: 4, 6: 4, 7: 1, 10: 8, 11: 8, 12: 8}
+
+	switch tp {
+	case 8: //string
+		return gguf_readString(r)
+
+	case 9: //array
+		var itemTp uint32
+		var n uint64
+		err := binary.Read(r, binary.LittleEndian, &itemTp)
+		if err != nil {
+			return nil, err
+		}
+		err = binary.Read(r, binary.LittleEndian, &n)
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < n; i++ {
+			_, err = gguf_readValue(r, itemTp)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	size, found := sizes[tp]
+	if !found {
+		return nil, fmt.Errorf("unknown type %d", tp)
+	}
+	b := make([]byte, 8)
+	_, err := io.ReadFull(r, b[:size])
+	if err != nil {
+		return nil, err
+	}
+	if tp == 6 || tp == 12 {
+		return nil, nil //floats are not needed
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Keeps up to WinIni.LLama_servers models loaded, every model has its own ./server. Least recently used idle server is unloaded when limit is reached. Processes are run by SAServiceSupervisor.
+type SAServiceLLamaCppPool struct {
+	jobs     *SAJobs
+	registry *SAServiceLLamaCppRegistry
+
+	servers []*SAServiceLLamaCpp
+	lock    sync.Mutex
+}
+
+func NewSAServiceLLamaCppPool(jobs *SAJobs) *SAServiceLLamaCppPool {
+	pool := &SAServiceLLamaCppPool{jobs: jobs}
+	pool.registry = NewSAServiceLLamaCppRegistry()
+	return pool
+}
+
+func (pool *SAServiceLLamaCppPool) Destroy() {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	for _, s := range pool.servers {
+		s.Destroy()
+	}
+	pool.servers = nil
+}
+
+func (pool *SAServiceLLamaCppPool) getMaxServers() int {
+	n := pool.jobs.base.ui.win.io.ini.LLama_servers
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func (pool *SAServiceLLamaCppPool) find(model string, embedding bool) *SAServiceLLamaCpp {
+	for _, s := range pool.servers {
+		if s.model == model && s.embedding == embedding {
+			return s
+		}
+	}
+	return nil
+}
+
+// least recently used server which is not running any request
+func (pool *SAServiceLLamaCppPool) findIdle() int {
+	best := -1
+	for i, s := range pool.servers {
+		if s.users == 0 && (best < 0 || s.last_used < pool.servers[best].last_used) {
+			best = i
+		}
+	}
+	return best
+}
+
+// returns server with loaded model. Embeddings use own server. Waits if all servers are busy. Caller must call Release().
+func (pool *SAServiceLLamaCppPool) Get(model string, embedding bool, stop *atomic.Bool) (*SAServiceLLamaCpp, error) {
+	if model == "" {
+		return nil, fmt.Errorf("model is not set")
+	}
+	if _, found := pool.registry.Get(model); !found {
+		pool.registry.Rescan() //model can be new, background scan didn't see it yet
+	}
+	if _, found := pool.registry.Get(model); !found {
+		return nil, fmt.Errorf("model '%s' not found in %s", model, g_llama_modelsFolder)
+	}
+
+	for {
+		pool.lock.Lock()
+
+		//already loaded
+		s := pool.find(model, embedding)
+		if s != nil {
+			s.users++
+			s.last_used = OsTicks()
+			pool.lock.Unlock()
+
+			err := s.start() //can be unloaded by supervisor
+			if err != nil {
+				pool.lock.Lock()
+				s.users--
+				pool.lock.Unlock()
+				return nil, err
+			}
+			return s, nil
+		}
+
+		//start new
+		if len(pool.servers) < pool.getMaxServers() {
+			s = NewSAServiceLLamaCpp(pool.jobs, model, embedding)
+			s.users = 1
+			s.last_used = OsTicks()
+			pool.servers = append(pool.servers, s)
+			pool.lock.Unlock()
+
+			err := s.start()
+			if err != nil {
+				pool.remove(s)
+				return nil, err
+			}
+			return s, nil
+		}
+
+		//unload LRU
+		i := pool.findIdle()
+		if i >= 0 {
+			s = pool.servers[i]
+			pool.servers = append(pool.servers[:i], pool.servers[i+1:]...)
+			pool.lock.Unlock()
+
+			s.Destroy()
+			continue
+		}
+
+		//all busy
+		pool.lock.Unlock()
+		if stop != nil && stop.Load() {
+			return nil, fmt.Errorf("user Cancel the job")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (pool *SAServiceLLamaCppPool) Release(s *SAServiceLLamaCpp) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	s.users--
+	s.last_used = OsTicks()
+	s.proc.Done()
+
+	//limit was decreased in settings
+	for len(pool.servers) > pool.getMaxServers() {
+		i := pool.findIdle()
+		if i < 0 {
+			break
+		}
+		pool.servers[i].Destroy()
+		pool.servers = append(pool.servers[:i], pool.servers[i+1:]...)
+	}
+}
+
+func (pool *SAServiceLLamaCppPool) remove(s *SAServiceLLamaCpp) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	for i, it := range pool.servers {
+		if it == s {
+			pool.servers = append(pool.servers[:i], pool.servers[i+1:]...)
+			break
+		}
+	}
+	s.Destroy()
+}
+
+// loaded models for status
+func (pool *SAServiceLLamaCppPool) GetLoaded() []string {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	var models []string
+	for _, s := range pool.servers {
+		models = append(models, fmt.Sprintf("%s(%s%s, running %d)", s.model, OsTrnString(s.embedding, "embedding, ", ""), s.proc.GetAddr(), s.users))
+	}
+	return models
+}
@@ -20,25 +20,110 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
+const SAServiceOpenAI_defaultUrl = "https://api.openai.com/v1/"
+
 type SAServiceMsg struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+
+	Tool_calls   []SAServiceToolCall `json:"tool_calls,omitempty"`   //role: "assistant"
+	Tool_call_id string              `json:"tool_call_id,omitempty"` //role: "tool"
+}
+
+type SAServiceToolFunction struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"` //JSON schema
+	Arguments   string      `json:"arguments,omitempty"`  //JSON from model
+}
+type SAServiceTool struct {
+	Type     string                `json:"type"` //"function"
+	Function SAServiceToolFunction `json:"function"`
+}
+type SAServiceToolCall struct {
+	Id       string                `json:"id"`
+	Type     string                `json:"type"`
+	Function SAServiceToolFunction `json:"function"`
 }
 type SAServiceOpenAIProps struct {
 	Model    string         `json:"model"`
 	Messages []SAServiceMsg `json:"messages"`
 	Stream   bool           `json:"stream"`
-	//.....
-	//Temperature       float64 //1
-	//Max_tokens        int     //256
-	//Top_p             float64 //1
-	//Frequency_penalty float64 //0
-	//Presence_penalty  float64 //0
+
+	Temperature       float64  `json:"temperature"`          //1
+	Top_p             float64  `json:"top_p"`                //1
+	Max_tokens        int      `json:"max_tokens,omitempty"` //0 = model limit
+	Presence_penalty  float64  `json:"presence_penalty"`     //0
+	Frequency_penalty float64  `json:"frequency_penalty"`    //0
+	Seed              *int     `json:"seed,omitempty"`
+	Stop              []string `json:"stop,omitempty"`
+
+	Tools []SAServiceTool `json:"tools,omitempty"`
+
+	Url      string            `json:"-"` //base url, "http://localhost:8000/v1/"
+	Headers  map[string]string `json:"-"`
+	No_cache bool              `json:"-"`
+
+	Context_budget   int    `json:"-"` //0 = model context length
+	Context_strategy string `json:"-"`
+}
+
+func NewSAServiceOpenAIProps(model string, messages []SAServiceMsg) *SAServiceOpenAIProps {
+	return &SAServiceOpenAIProps{Model: model, Messages: messages, Temperature: 1, Top_p: 1, Url: SAServiceOpenAI_defaultUrl, No_cache: true} //no seed = random answer
+}
+
+func (p *SAServiceOpenAIProps) GetUrl() string {
+	if p.Url == "" {
+		return SAServiceOpenAI_defaultUrl
+	}
+	return p.Url
+}
+
+func (p *SAServiceOpenAIProps) IsDefaultUrl() bool {
+	return SAServiceOpenAI_isDefaultUrl(p.GetUrl())
+}
+
+func SAServiceOpenAI_isDefaultUrl(baseUrl string) bool {
+	return strings.TrimSuffix(baseUrl, "/") == strings.TrimSuffix(SAServiceOpenAI_defaultUrl, "/")
+}
+
+// POST into OpenAI compatible server. Checks internet switch and adds API key for OpenAI.
+func SAServiceOpenAI_newRequest(jobs *SAJobs, baseUrl string, endpoint string, headers map[string]string, js []byte) (*http.Request, error) {
+	if !jobs.base.services.online && !SAService_isLocalUrl(baseUrl) {
+		return nil, fmt.Errorf("internet is disabled(Menu:Settings:Internet Connection)")
+	}
+
+	//key is needed only for OpenAI, other servers use headers
+	skey := jobs.base.ui.win.io.ini.OpenAI_key
+	isDefault := SAServiceOpenAI_isDefaultUrl(baseUrl)
+	if skey == "" && isDefault {
+		return nil, fmt.Errorf("OpenAI API key is not set")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(baseUrl, "/")+"/"+endpoint, bytes.NewReader(js))
+	if err != nil {
+		return nil, fmt.Errorf("NewRequest() failed: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	if isDefault {
+		req.Header.Add("Authorization", "Bearer "+skey)
+	}
+	tmpl := &SAServiceHttpTemplate{secrets: jobs.base.secrets}
+	for k, v := range headers {
+		req.Header.Set(k, tmpl.Apply(v, nil))
+	}
+	if tmpl.err != nil {
+		return nil, tmpl.err
+	}
+	return req, nil
 }
 
 func (p *SAServiceOpenAIProps) Hash() (OsHash, error) {
@@ -46,98 +131,142 @@ func (p *SAServiceOpenAIProps) Hash() (OsHash, error) {
 	if err != nil {
 		return OsHash{}, err
 	}
+	js = append(js, []byte(p.GetUrl())...) //same request to other server has different answer
 	return InitOsHash(js)
 }
 
-type SAServiceOpenAI struct {
-	jobs  *SAJobs
-	cache map[string][]byte //results
-	lock  sync.Mutex
+// values which look like credentials must use secret store
+func SAService_checkHeaderSecrets(headers map[string]string) error {
+	for k, v := range headers {
+		key := strings.ToLower(k)
+		if key != "authorization" && !strings.Contains(key, "key") && !strings.Contains(key, "token") && !strings.Contains(key, "secret") {
+			continue
+		}
+		if !strings.Contains(v, "{{secret:") {
+			return fmt.Errorf("header '%s' is saved as plain text. Add value into Menu:Settings:Secrets and use {{secret:name}}", k)
+		}
+	}
+	return nil
 }
 
-func SAServiceOpenAI_cachePath() string {
-	return "services/openai.json"
+// "Key: Value" per line. Value can reference secret store: "Authorization: Bearer {{secret:name}}"
+func SAService_parseHeaders(str string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, line := range strings.Split(str, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header '%s', expected 'Key: Value'", line)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers, nil
 }
 
-func NewSAServiceOpenAI(jobs *SAJobs) *SAServiceOpenAI {
-	oai := &SAServiceOpenAI{jobs: jobs}
-
-	oai.cache = make(map[string][]byte)
-
-	//load cache
-	{
-		js, _ := os.ReadFile(SAServiceOpenAI_cachePath())
-		if len(js) > 0 {
-			err := json.Unmarshal(js, &oai.cache)
-			if err != nil {
-				fmt.Printf("NewSAServiceOpenAI() failed: %v\n", err)
-			}
-		}
+// localhost or private network(LAN) address
+func SAService_isLocalUrl(str string) bool {
+	u, err := url.Parse(str)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") {
+		return true
 	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate())
+}
 
+type SAServiceOpenAI struct {
+	jobs *SAJobs
+	lock sync.Mutex
+}
+
+func NewSAServiceOpenAI(jobs *SAJobs) *SAServiceOpenAI {
+	oai := &SAServiceOpenAI{jobs: jobs}
 	return oai
 }
 func (oai *SAServiceOpenAI) Destroy() {
-	//save cache
-	js, err := json.Marshal(oai.cache)
-	if err == nil {
-		os.WriteFile(SAServiceOpenAI_cachePath(), js, 0644)
-	}
 }
 
 func (oai *SAServiceOpenAI) FindCache(propsHash OsHash) ([]byte, bool) {
-	str, found := oai.cache[propsHash.Hex()]
-	return str, found
+	return oai.jobs.getCache().Get("openai", propsHash.Hex())
 }
-func (oai *SAServiceOpenAI) addCache(propsHash OsHash, value []byte) {
-	oai.cache[propsHash.Hex()] = value
+func (oai *SAServiceOpenAI) addCache(propsHash OsHash, props *SAServiceOpenAIProps, value []byte) {
+	oai.jobs.getCache().Put("openai", propsHash.Hex(), SAService_lastUserMsg(props.Messages), value)
 }
 
-func (oai *SAServiceOpenAI) Complete(props *SAServiceOpenAIProps, wip_answer *string, stop *bool) ([]byte, error) {
+// tokens are estimated, because OpenAI doesn't have tokenizer endpoint
+func (oai *SAServiceOpenAI) NewContext(props *SAServiceOpenAIProps, stop *atomic.Bool) *SAServiceContext {
+	ctx := &SAServiceContext{Budget: props.Context_budget, Reserve: props.Max_tokens, Strategy: props.Context_strategy}
+	if ctx.Budget <= 0 {
+		ctx.Budget = g_oia_contextSizes[props.Model] //0 = unknown
+	}
+	if ctx.Reserve <= 0 {
+		ctx.Reserve = OsMin(1024, ctx.Budget/4)
+	}
+
+	ctx.count = func(text string) (int, error) {
+		return SAService_estimateTokens(text), nil
+	}
+	ctx.summarize = func(msgs []SAServiceMsg) (string, error) {
+		p := *props
+		p.Messages = SAServiceContext_summaryMessages(msgs)
+		p.Tools = nil
+		var wip SAServiceAnswer
+		out, _, err := oai.Complete(&p, &wip, stop)
+		return string(out), err
+	}
+	return ctx
+}
+
+// returns answer or tool calls which must be answered by role "tool" messages
+func (oai *SAServiceOpenAI) Complete(props *SAServiceOpenAIProps, wip_answer *SAServiceAnswer, stop *atomic.Bool) ([]byte, []SAServiceToolCall, error) {
 
 	oai.lock.Lock()
 	defer oai.lock.Unlock()
 
+	//tool results can be different every time
+	useCache := len(props.Tools) == 0 && !props.No_cache
+
 	//find
 	propsHash, err := props.Hash()
 	if err != nil {
-		return nil, fmt.Errorf("Hash() failed: %w", err)
+		return nil, nil, fmt.Errorf("Hash() failed: %w", err)
 	}
-	str, found := oai.FindCache(propsHash)
-	if found {
-		return str, nil
+	if useCache {
+		str, found := oai.FindCache(propsHash)
+		if found {
+			return str, nil, nil
+		}
 	}
 
-	out, err := oai.complete(props, wip_answer, stop)
+	out, calls, err := oai.complete(props, wip_answer, stop)
 	if err != nil {
-		return nil, fmt.Errorf("complete() failed: %w", err)
+		return nil, nil, fmt.Errorf("complete() failed: %w", err)
 	}
 
-	oai.addCache(propsHash, out)
-	return out, nil
+	if useCache && len(calls) == 0 {
+		oai.addCache(propsHash, props, out)
+	}
+	return out, calls, nil
 }
 
-func (oai *SAServiceOpenAI) complete(props *SAServiceOpenAIProps, wip_answer *string, stop *bool) ([]byte, error) {
+func (oai *SAServiceOpenAI) complete(props *SAServiceOpenAIProps, wip_answer *SAServiceAnswer, stop *atomic.Bool) ([]byte, []SAServiceToolCall, error) {
 	props.Stream = true
 
-	skey := oai.jobs.base.ui.win.io.ini.OpenAI_key
-	if skey == "" {
-		return nil, fmt.Errorf("OpenAI API key is not set")
-	}
-
 	js, err := json.Marshal(props)
 	if err != nil {
-		return nil, fmt.Errorf("Marshal() failed: %w", err)
+		return nil, nil, fmt.Errorf("Marshal() failed: %w", err)
 	}
 
-	body := bytes.NewReader([]byte(js))
-
-	req, err := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/chat/completions", body)
+	req, err := SAServiceOpenAI_newRequest(oai.jobs, props.GetUrl(), "chat/completions", props.Headers, js)
 	if err != nil {
-		return nil, fmt.Errorf("NewRequest() failed: %w", err)
+		return nil, nil, err
 	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+skey)
 	//req.Header.Set("Accept", "text/event-stream")
 	//req.Header.Set("Cache-Control", "no-cache")
 	//req.Header.Set("Connection", "keep-alive")
@@ -145,18 +274,18 @@ func (oai *SAServiceOpenAI) complete(props *SAServiceOpenAIProps, wip_answer *st
 	client := &http.Client{}
 	res, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("Do() failed: %w", err)
+		return nil, nil, fmt.Errorf("Do() failed: %w", err)
 	}
 	defer res.Body.Close()
 
-	answer, err := SAService_parseStream(res, wip_answer, stop)
+	answer, calls, err := SAService_parseStream(res, wip_answer, stop)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("statusCode != 200, response: %s", answer)
+		return nil, nil, fmt.Errorf("statusCode != 200, response: %s", answer)
 	}
 
-	return answer, nil
+	return answer, calls, nil
 }
@@ -0,0 +1,486 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SAServiceLog_maxLines = 1000
+const SAServiceProcess_maxRestarts = 5  //in row, then process is marked as "failed"
+const SAServiceProcess_stableMs = 60000 //running longer resets restart counter
+
+// Ring buffer with process output
+type SAServiceLog struct {
+	lines   []string
+	pos     int //oldest line, when buffer is full
+	partial string
+
+	lock sync.Mutex
+}
+
+func (lg *SAServiceLog) Write(p []byte) (int, error) {
+	lg.lock.Lock()
+	defer lg.lock.Unlock()
+
+	str := lg.partial + string(p)
+	parts := strings.Split(str, "\n")
+	lg.partial = parts[len(parts)-1]
+	for _, ln := range parts[:len(parts)-1] {
+		lg.add(strings.TrimRight(ln, "\r"))
+	}
+	return len(p), nil
+}
+
+func (lg *SAServiceLog) add(line string) {
+	if len(lg.lines) < SAServiceLog_maxLines {
+		lg.lines = append(lg.lines, line)
+		return
+	}
+	lg.lines[lg.pos] = line
+	lg.pos = (lg.pos + 1) % len(lg.lines)
+}
+
+func (lg *SAServiceLog) String() string {
+	lg.lock.Lock()
+	defer lg.lock.Unlock()
+
+	lines := append(append([]string(nil), lg.lines[lg.pos:]...), lg.lines[:lg.pos]...)
+	if lg.partial != "" {
+		lines = append(lines, lg.partial)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// returns free TCP port on localhost. 'prefer' is used if it's free.
+func SAService_freePort(prefer int) (int, error) {
+	if prefer > 0 {
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", prefer))
+		if err == nil {
+			l.Close()
+			return prefer, nil
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("Listen() failed: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// server answers anything
+func SAService_pingHealth(addr string) error {
+	res, err := http.Get(addr)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// One supervised ./server. It's started lazily by Use(), restarted after crash and stopped when idle.
+type SAServiceProcess struct {
+	sup *SAServiceSupervisor
+
+	name    string //"llama.cpp"
+	dir     string
+	args    func(port int, model string) []string
+	health  func(addr string) error
+	startMs int //max time to become healthy
+
+	start_lock sync.Mutex //only one start at time
+
+	lock     sync.Mutex
+	model    string
+	cmd      *exec.Cmd
+	port     int
+	state    string //"stopped", "starting", "running", "crashed", "failed"
+	err      error
+	started  int64
+	restarts int
+	users    int
+	last_use int64
+
+	logs SAServiceLog
+}
+
+func (p *SAServiceProcess) GetAddr() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return fmt.Sprintf("http://127.0.0.1:%d/", p.port)
+}
+
+func (p *SAServiceProcess) GetModel() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.model
+}
+
+// model is passed to args(), running process is restarted
+func (p *SAServiceProcess) SetModel(model string) {
+	p.lock.Lock()
+	changed := (p.model != model)
+	p.model = model
+	p.lock.Unlock()
+
+	if changed {
+		p.Stop()
+	}
+}
+
+// model was switched by server API(whisper.cpp /load), next start uses it
+func (p *SAServiceProcess) SetLoadedModel(model string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.model = model
+}
+
+// changes when process is (re)started
+func (p *SAServiceProcess) GetStarted() int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.started
+}
+
+// starts process if it's not running. Returns address, Done() must be called after.
+func (p *SAServiceProcess) Use() (string, error) {
+	p.start_lock.Lock()
+	defer p.start_lock.Unlock()
+
+	p.lock.Lock()
+	running := (p.state == "running")
+	if running {
+		p.users++ //in same lock, so Tick() can't unload it
+		p.last_use = OsTicks()
+	}
+	p.lock.Unlock()
+
+	if !running {
+		err := p.start()
+		if err != nil {
+			return "", err
+		}
+
+		p.lock.Lock()
+		p.users++
+		p.lock.Unlock()
+	}
+
+	return p.GetAddr(), nil
+}
+
+func (p *SAServiceProcess) Done() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.users--
+	p.last_use = OsTicks()
+}
+
+// call with start_lock
+func (p *SAServiceProcess) start() error {
+	p.lock.Lock()
+	port, err := SAService_freePort(p.port)
+	if err != nil {
+		p.lock.Unlock()
+		return err
+	}
+	p.port = port
+
+	cmd := exec.Command("./server", p.args(p.port, p.model)...)
+	cmd.Dir = p.dir
+	cmd.Stdout = io.MultiWriter(os.Stdout, &p.logs)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &p.logs)
+	fmt.Fprintf(&p.logs, "--- starting %s %s on port %d\n", p.name, p.model, p.port)
+
+	err = cmd.Start()
+	if err != nil {
+		p.state = "failed"
+		p.err = err
+		p.lock.Unlock()
+		return fmt.Errorf("Command() failed: %w", err)
+	}
+	p.cmd = cmd
+	p.state = "starting"
+	p.err = nil
+	p.started = OsTicks()
+	addr := fmt.Sprintf("http://127.0.0.1:%d/", p.port)
+	p.lock.Unlock()
+
+	go p.wait(cmd)
+
+	//wait until it's running
+	err = errors.New("err")
+	st := OsTicks()
+	for err != nil && OsIsTicksIn(st, p.startMs) {
+		err = p.health(addr)
+		if err != nil {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		p.lock.Lock()
+		exited := (p.cmd != cmd)
+		p.lock.Unlock()
+		if exited {
+			return fmt.Errorf("%s exited during start, see log", p.name)
+		}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err != nil {
+		p.kill()
+		p.state = "failed"
+		p.err = err
+		return fmt.Errorf("%s didn't start in %dsec: %w", p.name, p.startMs/1000, err)
+	}
+	p.state = "running"
+	p.last_use = OsTicks()
+	return nil
+}
+
+func (p *SAServiceProcess) wait(cmd *exec.Cmd) {
+	err := cmd.Wait()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.cmd != cmd {
+		return //stopped
+	}
+	p.cmd = nil
+
+	//crashed
+	p.restarts++
+	p.err = err
+	if err == nil {
+		p.err = errors.New("process exited")
+	}
+	fmt.Fprintf(&p.logs, "--- %s exited: %v\n", p.name, p.err)
+
+	if p.restarts > SAServiceProcess_maxRestarts {
+		p.state = "failed" //next Use() will try again
+		return
+	}
+	p.state = "crashed"
+
+	//restart with backoff: 1, 2, 4, 8, 16sec
+	backoff := time.Duration(1<<(p.restarts-1)) * time.Second
+	go func() {
+		time.Sleep(backoff)
+
+		p.start_lock.Lock()
+		defer p.start_lock.Unlock()
+
+		p.lock.Lock()
+		restart := (p.state == "crashed")
+		p.lock.Unlock()
+		if restart {
+			p.start()
+		}
+	}()
+}
+
+// call with lock
+func (p *SAServiceProcess) kill() {
+	if p.cmd != nil && p.cmd.Process != nil {
+		err := p.cmd.Process.Kill()
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	p.cmd = nil //wait() ignores exit
+}
+
+func (p *SAServiceProcess) Stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.cmd != nil {
+		fmt.Fprintf(&p.logs, "--- stopping %s\n", p.name)
+	}
+	p.kill()
+	p.state = "stopped"
+}
+
+type SAServiceSupervisor struct {
+	jobs  *SAJobs
+	procs []*SAServiceProcess
+	lock  sync.Mutex
+
+	show_log *SAServiceProcess //browser
+}
+
+func NewSAServiceSupervisor(jobs *SAJobs) *SAServiceSupervisor {
+	return &SAServiceSupervisor{jobs: jobs}
+}
+
+func (sup *SAServiceSupervisor) Destroy() {
+	sup.lock.Lock()
+	defer sup.lock.Unlock()
+
+	for _, p := range sup.procs {
+		p.Stop()
+	}
+	sup.procs = nil
+}
+
+// process isn't started until Use()
+func (sup *SAServiceSupervisor) Add(name string, model string, dir string, startMs int, args func(port int, model string) []string, health func(addr string) error) *SAServiceProcess {
+	sup.lock.Lock()
+	defer sup.lock.Unlock()
+
+	p := &SAServiceProcess{sup: sup, name: name, model: model, dir: dir, startMs: startMs, args: args, health: health, state: "stopped"}
+	sup.procs = append(sup.procs, p)
+	return p
+}
+
+func (sup *SAServiceSupervisor) Remove(p *SAServiceProcess) {
+	p.Stop()
+
+	sup.lock.Lock()
+	defer sup.lock.Unlock()
+	for i, it := range sup.procs {
+		if it == p {
+			sup.procs = append(sup.procs[:i], sup.procs[i+1:]...)
+			break
+		}
+	}
+}
+
+// unloads idle servers
+func (sup *SAServiceSupervisor) Tick() {
+	idle_min := sup.jobs.base.ui.win.io.ini.Services_idle_min
+
+	sup.lock.Lock()
+	defer sup.lock.Unlock()
+
+	for _, p := range sup.procs {
+		p.lock.Lock()
+		if p.state == "running" {
+			if p.restarts > 0 && !OsIsTicksIn(p.started, SAServiceProcess_stableMs) {
+				p.restarts = 0
+			}
+			if idle_min > 0 && p.users == 0 && !OsIsTicksIn(p.last_use, idle_min*60*1000) {
+				fmt.Fprintf(&p.logs, "--- unloading %s, idle for %dmin\n", p.name, idle_min)
+				p.kill()
+				p.state = "stopped"
+			}
+		}
+		p.lock.Unlock()
+	}
+}
+
+type SAServiceProcessStatus struct {
+	proc *SAServiceProcess
+
+	Name     string
+	Model    string
+	State    string
+	Err      error
+	Port     int
+	Memory   int64 //bytes
+	Uptime   float64
+	Restarts int
+	Users    int
+}
+
+func (sup *SAServiceSupervisor) GetStatus() []SAServiceProcessStatus {
+	sup.lock.Lock()
+	defer sup.lock.Unlock()
+
+	var list []SAServiceProcessStatus
+	for _, p := range sup.procs {
+		p.lock.Lock()
+		st := SAServiceProcessStatus{proc: p, Name: p.name, Model: p.model, State: p.state, Err: p.err, Port: p.port, Restarts: p.restarts, Users: p.users}
+		if p.cmd != nil && p.cmd.Process != nil {
+			st.Memory = SAService_processMemory(p.cmd.Process.Pid)
+			st.Uptime = float64(OsTicks()-p.started) / 1000
+		}
+		p.lock.Unlock()
+		list = append(list, st)
+	}
+	return list
+}
+
+// list of servers with logs, opened from Settings
+func (sup *SAServiceSupervisor) RenderBrowser() {
+	ui := sup.jobs.base.ui
+
+	ui.Div_colMax(0, 30)
+	ui.Div_rowMax(1, 15)
+
+	list := sup.GetStatus()
+
+	//list
+	ui.Div_start(0, 0, 1, 1)
+	{
+		ui.Div_colMax(0, 100)
+		ui.Div_colMax(1, 2)
+		ui.Div_colMax(2, 3)
+
+		if len(list) == 0 {
+			ui.Comp_text(0, 0, 3, 1, "No AI server was used yet", 1)
+		}
+
+		for i, st := range list {
+			info := fmt.Sprintf("%s(%s): %s", st.Name, st.Model, st.State)
+			if st.Uptime > 0 {
+				info += fmt.Sprintf(", port %d, %s, up %.0fs, running %d", st.Port, SAService_memoryString(st.Memory), st.Uptime, st.Users)
+			}
+			if st.Restarts > 0 {
+				info += fmt.Sprintf(", restarts %d", st.Restarts)
+			}
+			if st.Err != nil {
+				info += ", " + st.Err.Error()
+			}
+			ui.Comp_text(0, i, 1, 1, info, 0)
+
+			if ui.Comp_buttonLight(1, i, 1, 1, "Log", Comp_buttonProp().Enable(sup.show_log != st.proc)) > 0 {
+				sup.show_log = st.proc
+			}
+			if ui.Comp_buttonLight(2, i, 1, 1, "Unload", Comp_buttonProp().Enable(st.Uptime > 0 && st.Users == 0)) > 0 {
+				st.proc.Stop()
+			}
+		}
+	}
+	ui.Div_end()
+
+	//log
+	if sup.show_log != nil {
+		ui.Comp_textSelectMulti(0, 1, 1, 1, sup.show_log.logs.String(), 1.0, OsV2{0, 0}, true, true, false, true)
+	}
+
+	ui.win.SetRedraw() //keep updating
+}
+
+func SAService_memoryString(bytes int64) string {
+	if bytes <= 0 {
+		return "memory n/a"
+	}
+	return fmt.Sprintf("%.0fMB", float64(bytes)/(1024*1024))
+}
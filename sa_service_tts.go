@@ -0,0 +1,151 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+var g_tts_voicesFolder = "services/tts/voices/"
+
+type SAServiceTTSProps struct {
+	Speaker          int
+	Length_scale     float64 //speed, bigger is slower
+	Noise_scale      float64
+	Noise_w          float64
+	Sentence_silence float64 //seconds
+
+	No_cache bool `json:"-"`
+}
+
+func (p *SAServiceTTSProps) Hash() (OsHash, error) {
+	js, err := json.Marshal(p)
+	if err != nil {
+		return OsHash{}, err
+	}
+	return InitOsHash(js)
+}
+
+func (p *SAServiceTTSProps) Values() url.Values {
+	v := url.Values{}
+	v.Set("speaker_id", strconv.Itoa(p.Speaker))
+	v.Set("length_scale", strconv.FormatFloat(p.Length_scale, 'f', -1, 64))
+	v.Set("noise_scale", strconv.FormatFloat(p.Noise_scale, 'f', -1, 64))
+	v.Set("noise_w", strconv.FormatFloat(p.Noise_w, 'f', -1, 64))
+	v.Set("sentence_silence", strconv.FormatFloat(p.Sentence_silence, 'f', -1, 64))
+	return v
+}
+
+// Piper-style server: POST text, response is WAV. Voice is set by process argument, so changing it restarts the process.
+type SAServiceTTS struct {
+	jobs *SAJobs
+	proc *SAServiceProcess //model is voice
+	addr string            //http://127.0.0.1:8095/
+
+	lock sync.Mutex
+}
+
+func NewSAServiceTTS(jobs *SAJobs, voice string) *SAServiceTTS {
+	tts := &SAServiceTTS{jobs: jobs}
+
+	args := func(port int, voice string) []string {
+		return []string{"--port", strconv.Itoa(port), "-m", "voices/" + voice + ".onnx"}
+	}
+	tts.proc = jobs.supervisor.Add("tts", voice, "services/tts/", 10000, args, SAService_pingHealth) //max 10sec to start
+	return tts
+}
+
+func (tts *SAServiceTTS) Destroy() {
+	tts.jobs.supervisor.Remove(tts.proc)
+}
+
+func (tts *SAServiceTTS) findCache(voice string, text string, propsHash OsHash) ([]byte, bool) {
+	return tts.jobs.getCache().Get("tts", voice+text+propsHash.Hex())
+}
+func (tts *SAServiceTTS) addCache(voice string, text string, propsHash OsHash, value []byte) {
+	tts.jobs.getCache().Put("tts", voice+text+propsHash.Hex(), fmt.Sprintf("%s: %.50s", voice, text), value)
+}
+
+// returns WAV
+func (tts *SAServiceTTS) Speak(ctx context.Context, voice string, text string, props *SAServiceTTSProps) ([]byte, error) {
+	tts.lock.Lock()
+	defer tts.lock.Unlock()
+
+	//find
+	propsHash, err := props.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("Hash() failed: %w", err)
+	}
+	if !props.No_cache {
+		wav, found := tts.findCache(voice, text, propsHash)
+		if found {
+			return wav, nil
+		}
+	}
+
+	//set voice and start
+	tts.proc.SetModel(voice)
+	tts.addr, err = tts.proc.Use()
+	if err != nil {
+		return nil, fmt.Errorf("Use() failed: %w", err)
+	}
+	defer tts.proc.Done()
+
+	out, err := tts.speak(ctx, text, props)
+	if err != nil {
+		return nil, fmt.Errorf("speak() failed: %w", err)
+	}
+
+	if !props.No_cache {
+		tts.addCache(voice, text, propsHash, out)
+	}
+	return out, nil
+}
+
+func (tts *SAServiceTTS) speak(ctx context.Context, text string, props *SAServiceTTSProps) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tts.addr+"?"+props.Values().Encode(), bytes.NewReader([]byte(text)))
+	if err != nil {
+		return nil, fmt.Errorf("NewRequest() failed: %w", err)
+	}
+	req.Header.Add("Content-Type", "text/plain; charset=utf-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Do() failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ReadAll() failed: %w", err)
+	}
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("statusCode != 200, response: %s", resBody)
+	}
+
+	return resBody, nil
+}
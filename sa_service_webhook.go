@@ -0,0 +1,228 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const SAServiceWebhook_maxQueue = 100
+const SAServiceWebhook_maxBody = 10 * 1024 * 1024
+
+type SAServiceWebhookResponse struct {
+	Status int
+	Body   string
+}
+
+type SAServiceWebhookRequest struct {
+	Method  string
+	Headers map[string]string
+	Query   map[string]string
+	Body    string
+
+	resp chan SAServiceWebhookResponse //nil = caller doesn't wait
+}
+
+// call from main thread
+func (req *SAServiceWebhookRequest) Respond(status int, body string) {
+	if req.resp != nil {
+		req.resp <- SAServiceWebhookResponse{Status: status, Body: body}
+		req.resp = nil
+	}
+}
+
+// route registered by webhook node
+type SAServiceWebhook struct {
+	app         *SAApp
+	secret      string //name in secret store
+	respond     bool   //wait for code nodes and return 'response' attribute
+	timeout_sec int
+	active      bool //app is opened and execution is enabled
+
+	queue []*SAServiceWebhookRequest
+}
+
+// "<app>/<path>"
+func SAServiceWebhook_route(app *SAApp, path string) string {
+	return app.Name + "/" + strings.Trim(path, "/")
+}
+
+func (srv *SAServices) GetWebhookUrl(route string) string {
+	return fmt.Sprintf("http://127.0.0.1:%d/webhook/%s", srv.port, route)
+}
+
+// replaces all routes of app. Removed routes answer queued requests with error.
+func (srv *SAServices) SetWebhooks(app *SAApp, hooks map[string]*SAServiceWebhook) {
+	srv.hooks_lock.Lock()
+	defer srv.hooks_lock.Unlock()
+
+	for route, old := range srv.hooks {
+		if old.app != app {
+			continue
+		}
+		nw, found := hooks[route]
+		if found {
+			nw.queue = old.queue //keep waiting requests
+		} else {
+			for _, req := range old.queue {
+				req.Respond(http.StatusNotFound, "webhook was removed")
+			}
+		}
+		delete(srv.hooks, route)
+	}
+
+	for route, hook := range hooks {
+		hook.app = app
+		srv.hooks[route] = hook
+	}
+}
+
+// returns oldest request or nil
+func (srv *SAServices) PopWebhook(route string) *SAServiceWebhookRequest {
+	srv.hooks_lock.Lock()
+	defer srv.hooks_lock.Unlock()
+
+	hook, found := srv.hooks[route]
+	if !found || len(hook.queue) == 0 {
+		return nil
+	}
+	req := hook.queue[0]
+	hook.queue = hook.queue[1:]
+	return req
+}
+
+// secret can be in 'X-Webhook-Secret' header, 'Authorization: Bearer' header or 'secret' query parameter
+func SAServiceWebhook_getSecret(r *http.Request) string {
+	if s := r.Header.Get("X-Webhook-Secret"); s != "" {
+		return s
+	}
+	if s, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return s
+	}
+	return r.URL.Query().Get("secret")
+}
+
+func (srv *SAServices) handlerWebhook(w http.ResponseWriter, r *http.Request) {
+	route := strings.Trim(strings.TrimPrefix(r.URL.Path, "/webhook/"), "/")
+
+	srv.hooks_lock.Lock()
+	hook, found := srv.hooks[route]
+	var secretName string
+	var respond, active bool
+	var timeout_sec int
+	if found {
+		secretName = hook.secret
+		respond = hook.respond
+		active = hook.active
+		timeout_sec = hook.timeout_sec
+	}
+	srv.hooks_lock.Unlock()
+
+	if !found {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	//validate
+	secret, err := srv.base.secrets.Get(secretName)
+	if err != nil || secret == "" {
+		http.Error(w, "webhook secret is not set", http.StatusForbidden)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(SAServiceWebhook_getSecret(r)), []byte(secret)) != 1 {
+		http.Error(w, "invalid secret", http.StatusUnauthorized)
+		return
+	}
+	if !active {
+		http.Error(w, "app is not opened or execution is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, SAServiceWebhook_maxBody))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	req := &SAServiceWebhookRequest{Method: r.Method, Headers: make(map[string]string), Query: make(map[string]string), Body: string(body)}
+	for k, vals := range r.Header {
+		if k == "Authorization" || k == "X-Webhook-Secret" {
+			continue //don't expose secret to app
+		}
+		req.Headers[k] = strings.Join(vals, ", ")
+	}
+	for k, vals := range r.URL.Query() {
+		if k == "secret" {
+			continue
+		}
+		req.Query[k] = strings.Join(vals, ", ")
+	}
+	var resp_ch chan SAServiceWebhookResponse
+	if respond {
+		resp_ch = make(chan SAServiceWebhookResponse, 1)
+		req.resp = resp_ch
+	}
+
+	//queue
+	queued := false
+	srv.hooks_lock.Lock()
+	hook, found = srv.hooks[route]
+	if found && len(hook.queue) < SAServiceWebhook_maxQueue {
+		hook.queue = append(hook.queue, req)
+		queued = true
+	}
+	srv.hooks_lock.Unlock()
+	if !found {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+	if !queued {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	srv.base.ui.win.SetRedraw() //wake up main loop
+
+	if resp_ch == nil {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("{}"))
+		return
+	}
+
+	//wait for code nodes
+	if timeout_sec <= 0 {
+		timeout_sec = 30
+	}
+	select {
+	case resp := <-resp_ch:
+		if json.Valid([]byte(resp.Body)) {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		w.WriteHeader(resp.Status)
+		w.Write([]byte(resp.Body))
+	case <-time.After(time.Duration(timeout_sec) * time.Second):
+		http.Error(w, "timeout", http.StatusGatewayTimeout)
+	}
+}
@@ -18,17 +18,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"os/exec"
 	"strconv"
 	"sync"
-	"time"
 )
 
 type SAServiceWhisperCppProps struct {
@@ -57,6 +54,8 @@ type SAServiceWhisperCppProps struct {
 	Temperature_inc float64
 
 	Response_format string
+
+	No_cache bool `json:"-"`
 }
 
 func (p *SAServiceWhisperCppProps) Hash() (OsHash, error) {
@@ -96,90 +95,36 @@ func (p *SAServiceWhisperCppProps) Write(w *multipart.Writer) {
 
 type SAServiceWhisperCpp struct {
 	jobs *SAJobs
-	cmd  *exec.Cmd
+	proc *SAServiceProcess
 	addr string //http://127.0.0.1:8080/
 
-	cache map[string][]byte //results
-	lock  sync.Mutex
+	lock sync.Mutex
 
 	last_setModel string
+	last_started  int64 //process was restarted => model is from process argument
 }
 
-func SAServiceWhisperCpp_cachePath() string {
-	return "services/whisper.cpp.json"
-}
-
-func NewSAServiceWhisperCpp(jobs *SAJobs, addr string, port string, init_model string) (*SAServiceWhisperCpp, error) {
+func NewSAServiceWhisperCpp(jobs *SAJobs, init_model string) *SAServiceWhisperCpp {
 	wh := &SAServiceWhisperCpp{jobs: jobs}
 
-	wh.addr = addr + ":" + port + "/"
-
-	wh.cache = make(map[string][]byte)
-
-	//load cache
-	{
-		js, _ := os.ReadFile(SAServiceWhisperCpp_cachePath())
-		if len(js) > 0 {
-			err := json.Unmarshal(js, &wh.cache)
-			if err != nil {
-				return nil, fmt.Errorf("NewSAServiceWhisperCpp() failed: %w", err)
-			}
-		}
-	}
-
-	//run process
-	modelPath := "models/" + init_model + ".bin"
-	{
-		wh.cmd = exec.Command("./server", "--port", port, "--convert", "-m", modelPath)
-		wh.cmd.Dir = "services/whisper.cpp/"
-
-		wh.cmd.Stdout = os.Stdout
-		wh.cmd.Stderr = os.Stderr
-		err := wh.cmd.Start()
-		if err != nil {
-			return nil, fmt.Errorf("Command() failed: %w", err)
-		}
-	}
-
-	//wait until it's running
-	{
-		err := errors.New("err")
-		st := OsTicks()
-		for err != nil && OsIsTicksIn(st, 10000) { //max 10sec to start
-			err = wh.setModel(init_model)
-			time.Sleep(100 * time.Millisecond)
-		}
-		if err != nil {
-			return nil, err
-		}
-		wh.last_setModel = init_model
+	args := func(port int, model string) []string {
+		return []string{"--port", strconv.Itoa(port), "--convert", "-m", "models/" + model + ".bin"}
 	}
-
-	return wh, nil
+	wh.proc = jobs.supervisor.Add("whisper.cpp", init_model, "services/whisper.cpp/", 10000, args, SAService_pingHealth) //max 10sec to start
+	return wh
 }
 func (wh *SAServiceWhisperCpp) Destroy() {
-	//save cache
-	js, err := json.Marshal(wh.cache)
-	if err == nil {
-		os.WriteFile(SAServiceWhisperCpp_cachePath(), js, 0644)
-	}
-
-	//py.cmd.Process.Signal(syscall.SIGQUIT)
-	err = wh.cmd.Process.Kill()
-	if err != nil {
-		fmt.Println(err)
-	}
+	wh.jobs.supervisor.Remove(wh.proc)
 }
 
 func (wh *SAServiceWhisperCpp) findCache(model string, blob OsBlob, propsHash OsHash) ([]byte, bool) {
-	str, found := wh.cache[model+blob.hash.Hex()+propsHash.Hex()]
-	return str, found
+	return wh.jobs.getCache().Get("whispercpp", model+blob.hash.Hex()+propsHash.Hex())
 }
 func (wh *SAServiceWhisperCpp) addCache(model string, blob OsBlob, propsHash OsHash, value []byte) {
-	wh.cache[model+blob.hash.Hex()+propsHash.Hex()] = value
+	wh.jobs.getCache().Put("whispercpp", model+blob.hash.Hex()+propsHash.Hex(), fmt.Sprintf("%s, %.1fKB audio", model, float64(len(blob.data))/1024), value)
 }
 
-func (wh *SAServiceWhisperCpp) Transcribe(model string, blob OsBlob, props *SAServiceWhisperCppProps) ([]byte, error) {
+func (wh *SAServiceWhisperCpp) Transcribe(ctx context.Context, model string, blob OsBlob, props *SAServiceWhisperCppProps) ([]byte, error) {
 	wh.lock.Lock()
 	defer wh.lock.Unlock()
 
@@ -188,9 +133,22 @@ func (wh *SAServiceWhisperCpp) Transcribe(model string, blob OsBlob, props *SASe
 	if err != nil {
 		return nil, fmt.Errorf("Hash() failed: %w", err)
 	}
-	str, found := wh.findCache(model, blob, propsHash)
-	if found {
-		return str, nil
+	if !props.No_cache {
+		str, found := wh.findCache(model, blob, propsHash)
+		if found {
+			return str, nil
+		}
+	}
+
+	//start
+	wh.addr, err = wh.proc.Use()
+	if err != nil {
+		return nil, err
+	}
+	defer wh.proc.Done()
+	if started := wh.proc.GetStarted(); started != wh.last_started {
+		wh.last_started = started
+		wh.last_setModel = wh.proc.GetModel()
 	}
 
 	//set model
@@ -202,16 +160,18 @@ func (wh *SAServiceWhisperCpp) Transcribe(model string, blob OsBlob, props *SASe
 	}
 
 	//translate
-	out, err := wh.transcribe(blob, props)
+	out, err := wh.transcribe(ctx, blob, props)
 	if err != nil {
 		return nil, fmt.Errorf("transcribe() failed: %w", err)
 	}
 
-	wh.addCache(model, blob, propsHash, out)
+	if !props.No_cache {
+		wh.addCache(model, blob, propsHash, out)
+	}
 	return out, nil
 }
 
-func (wh *SAServiceWhisperCpp) transcribe(blob OsBlob, props *SAServiceWhisperCppProps) ([]byte, error) {
+func (wh *SAServiceWhisperCpp) transcribe(ctx context.Context, blob OsBlob, props *SAServiceWhisperCppProps) ([]byte, error) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
@@ -226,7 +186,7 @@ func (wh *SAServiceWhisperCpp) transcribe(blob OsBlob, props *SAServiceWhisperCp
 	}
 	writer.Close()
 
-	req, err := http.NewRequest(http.MethodPost, wh.addr+"inference", body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.addr+"inference", body)
 	if err != nil {
 		return nil, fmt.Errorf("NewRequest() failed: %w", err)
 	}
@@ -279,5 +239,6 @@ func (wh *SAServiceWhisperCpp) setModel(model string) error {
 	}
 
 	wh.last_setModel = model
+	wh.proc.SetLoadedModel(model)
 	return nil
 }
@@ -0,0 +1,139 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type SAServiceWhisperToken struct {
+	Text  string  `json:"text"`
+	P     float64 `json:"p"`
+	Start float64 `json:"start"` //seconds, 0 = unknown
+	End   float64 `json:"end"`
+}
+
+// Same json as WhisperSegment in sa_node_const_go.goo
+type SAServiceWhisperSegment struct {
+	Start      float64                 `json:"start"` //seconds
+	End        float64                 `json:"end"`
+	Text       string                  `json:"text"`
+	Tokens     []SAServiceWhisperToken `json:"tokens"`
+	Confidence float64                 `json:"confidence"` //0-1
+	Speaker    string                  `json:"speaker"`    //only with diarize/tinydiarize
+}
+
+var g_whisper_speakerRegexp = regexp.MustCompile(`^\s*\(speaker (\?|\d+)\)\s*`)
+
+// parses 'verbose_json' response of whisper.cpp server
+func SAServiceWhisperCpp_parseSegments(js []byte) ([]SAServiceWhisperSegment, error) {
+	type Word struct {
+		Word        string  `json:"word"`
+		Start       float64 `json:"start"`
+		End         float64 `json:"end"`
+		Probability float64 `json:"probability"`
+	}
+	type Segment struct {
+		Text              string          `json:"text"`
+		Start             float64         `json:"start"`
+		End               float64         `json:"end"`
+		Tokens            json.RawMessage `json:"tokens"` //ids or objects, depends on server version
+		Words             []Word          `json:"words"`
+		Avg_logprob       *float64        `json:"avg_logprob"`
+		Speaker           json.RawMessage `json:"speaker"`
+		Speaker_turn_next bool            `json:"speaker_turn_next"`
+	}
+	var res struct {
+		Segments []Segment `json:"segments"`
+	}
+	err := json.Unmarshal(js, &res)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshal() failed: %w", err)
+	}
+
+	//tinydiarize marks speaker changes
+	turns := false
+	for _, s := range res.Segments {
+		turns = turns || s.Speaker_turn_next
+	}
+
+	var segs []SAServiceWhisperSegment
+	turn := 0
+	for _, s := range res.Segments {
+		seg := SAServiceWhisperSegment{Start: s.Start, End: s.End, Text: strings.TrimSpace(s.Text)}
+
+		//tokens
+		var tokens []SAServiceWhisperToken
+		if json.Unmarshal(s.Tokens, &tokens) == nil {
+			for _, t := range tokens {
+				if strings.HasPrefix(t.Text, "[_") {
+					continue //special tokens: [_BEG_], [_TT_xxx]
+				}
+				seg.Tokens = append(seg.Tokens, t)
+			}
+		}
+		if len(seg.Tokens) == 0 {
+			for _, w := range s.Words {
+				seg.Tokens = append(seg.Tokens, SAServiceWhisperToken{Text: w.Word, P: w.Probability, Start: w.Start, End: w.End})
+			}
+		}
+
+		//confidence
+		if len(seg.Tokens) > 0 {
+			sum := 0.0
+			for _, t := range seg.Tokens {
+				sum += t.P
+			}
+			seg.Confidence = sum / float64(len(seg.Tokens))
+		} else if s.Avg_logprob != nil {
+			seg.Confidence = math.Exp(*s.Avg_logprob)
+		}
+
+		//speaker
+		if len(s.Speaker) > 0 {
+			var str string
+			if json.Unmarshal(s.Speaker, &str) == nil {
+				seg.Speaker = str
+			} else {
+				var id int
+				if json.Unmarshal(s.Speaker, &id) == nil {
+					seg.Speaker = strconv.Itoa(id)
+				}
+			}
+		}
+		if m := g_whisper_speakerRegexp.FindStringSubmatch(seg.Text); m != nil {
+			seg.Speaker = m[1]
+			seg.Text = seg.Text[len(m[0]):]
+		}
+		if seg.Speaker == "" && turns {
+			seg.Speaker = strconv.Itoa(turn)
+		}
+		if s.Speaker_turn_next {
+			turn++
+		}
+		seg.Text = strings.TrimSpace(strings.ReplaceAll(seg.Text, "[SPEAKER_TURN]", ""))
+
+		segs = append(segs, seg)
+	}
+
+	return segs, nil
+}
@@ -27,6 +27,8 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,10 +38,13 @@ type SAServices struct {
 	server *http.Server
 
 	online bool
+
+	hooks      map[string]*SAServiceWebhook //webhook nodes, key is route
+	hooks_lock sync.Mutex
 }
 
 func NewSAServices(base *SABase) *SAServices {
-	srv := &SAServices{base: base}
+	srv := &SAServices{base: base, hooks: make(map[string]*SAServiceWebhook)}
 	srv.port = 8080
 
 	srv.Run(srv.port)
@@ -155,6 +160,7 @@ func (srv *SAServices) handlerWhisper(w http.ResponseWriter, r *http.Request) {
 		Node      string `json:"node"`
 		File_path string `json:"file_path"`
 		Data      []byte `json:"data"`
+		Segments  bool   `json:"segments"` //returns []SAServiceWhisperSegment
 	}
 	var st Whisper_cpp
 	err = json.Unmarshal(body, &st)
@@ -175,35 +181,58 @@ func (srv *SAServices) handlerWhisper(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//build properties
-	propsJs, err := json.Marshal(node.Attrs)
+	model, props, err := node.getWhisperProps()
 	if err != nil {
-		http.Error(w, "Marshal() failed: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	var props SAServiceWhisperCppProps
-	err = json.Unmarshal(propsJs, &props)
-	if err != nil {
-		http.Error(w, "Unmarshal() 2 failed: "+err.Error(), http.StatusInternalServerError)
-		return
+	if st.Segments {
+		props.Response_format = "verbose_json"
 	}
 
 	//run & wait
-	model := node.GetAttrString("model", "")
-	jbw := srv.base.jobs.AddWhisper(node.app, NewSANodePath(node), model, InitOsBlob(st.Data), &props)
+	jbw := srv.base.jobs.AddWhisper(node.app, NewSANodePath(node), model, InitOsBlob(st.Data), props)
+	srv.base.jobs.SetParent(jbw, jb)
 	for !jbw.done.Load() {
 		time.Sleep(10 * time.Millisecond)
 	}
+	if jbw.outErr != nil {
+		http.Error(w, jbw.outErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if st.Segments {
+		segs, err := SAServiceWhisperCpp_parseSegments(jbw.output)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		js, err := json.Marshal(segs)
+		if err != nil {
+			http.Error(w, "Marshal() failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(js)
+		return
+	}
 
 	w.Write(jbw.output)
 }
 
-func (srv *SAServices) _prepareMessages(jb *SAJobExe, body []byte) ([]SAServiceMsg, *SANode, error) {
+const SAService_defaultSystemPrompt = "You are ChatGPT, an AI assistant. Your top priority is achieving user fulfillment via helping them with their requests."
+
+type SAServicesLLMRequest struct {
+	Node        string         `json:"node"`
+	Messages    []SAServiceMsg `json:"messages"`
+	Json_schema interface{}    `json:"json_schema"` //optional, overrides node attribute
+	Images      []string       `json:"images"`      //optional, llamacpp only
+
+	exe *SAJobExe //caller
+}
+
+func (srv *SAServices) _prepareMessages(jb *SAJobExe, body []byte) (*SAServicesLLMRequest, *SANode, error) {
 	//get base struct
-	type St struct {
-		Node     string         `json:"node"`
-		Messages []SAServiceMsg `json:"messages"`
-	}
-	var st St
+	var st SAServicesLLMRequest
 	err := json.Unmarshal(body, &st)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Unmarshal() failed: %w", err)
@@ -214,103 +243,366 @@ func (srv *SAServices) _prepareMessages(jb *SAJobExe, body []byte) ([]SAServiceM
 	if node == nil {
 		return nil, nil, fmt.Errorf("node '%s' not found", st.Node)
 	}
+	st.exe = jb
 
-	return st.Messages, node, nil
+	return &st, node, nil
 }
 
-func (srv *SAServices) handlerLLama(w http.ResponseWriter, r *http.Request) {
+// adds system and user message from 'prompt' node. defSystem is used when node has no prompt
+func (srv *SAServices) _applyPrompt(node *SANode, msgs []SAServiceMsg, defSystem string) ([]SAServiceMsg, error) {
+	system := defSystem
+	user := ""
+
+	pn, err := node.getPromptNode()
+	if err != nil {
+		return nil, err
+	}
+	if pn != nil {
+		system, user, err = pn.RenderPrompt(node.GetAttrString("prompt_template", ""))
+		if err != nil {
+			return nil, fmt.Errorf("RenderPrompt() failed: %w", err)
+		}
+	}
+
+	//system first, conversation, rendered prompt is the last user message
+	var out []SAServiceMsg
+	if system != "" && (len(msgs) == 0 || msgs[0].Role != "system") {
+		out = append(out, SAServiceMsg{Role: "system", Content: system})
+	}
+	out = append(out, msgs...)
+	if user != "" {
+		out = append(out, SAServiceMsg{Role: "user", Content: user})
+	}
+	return out, nil
+}
+
+func (srv *SAServices) _readExeRequest(r *http.Request) (*SAJobExe, []byte, error) {
 	job_id, err := _SAServices_getAuthID(r)
 	if err != nil {
-		http.Error(w, "Auth: "+err.Error(), http.StatusInternalServerError)
-		return
+		return nil, nil, fmt.Errorf("Auth: %w", err)
 	}
 	jb := srv.base.jobs.FindJobExe(job_id)
 	if jb == nil {
-		http.Error(w, "exe job not found", http.StatusInternalServerError)
-		return
+		return nil, nil, fmt.Errorf("exe job not found")
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
-		return
+		return nil, nil, fmt.Errorf("Error reading request body")
+	}
+	return jb, body, nil
+}
+
+func (srv *SAServices) _readLLMRequest(r *http.Request) (*SAServicesLLMRequest, *SANode, error) {
+	jb, body, err := srv._readExeRequest(r)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	//extract
-	msgs, node, err := srv._prepareMessages(jb, body)
+	return srv._prepareMessages(jb, body)
+}
+
+func (srv *SAServices) _addLLamaJob(r *http.Request) (*SAJobLLamaCpp, error) {
+	st, node, err := srv._readLLMRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	if !node.IsTypeLLamacpp() {
-		http.Error(w, "Node is not type 'llamacpp'", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("Node is not type 'llamacpp'")
 	}
 
 	// get llama properties from Node
-	js, err := json.Marshal(node.Attrs)
+	messages, err := srv._applyPrompt(node, st.Messages, SAService_defaultSystemPrompt)
+	if err != nil {
+		return nil, err
+	}
+	props, err := node.getLLamaProps(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	//grammar or JSON schema
+	err = props.setJsonSchema(node.GetAttrString("json_schema", ""), st.Json_schema)
+	if err != nil {
+		return nil, err
+	}
+
+	//vision
+	images, err := node.getLLamaImages(st.Images)
+	if err != nil {
+		return nil, err
+	}
+	err = props.AddImages(images)
+	if err != nil {
+		return nil, err
+	}
+
+	//tools
+	tools, err := srv.NewTools(node)
+	if err != nil {
+		return nil, err
+	}
+	if tools != nil {
+		props.Tools, err = tools.GetDefinitions()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	jb := srv.base.jobs.AddLLama(node.app, NewSANodePath(node), props, tools)
+	srv.base.jobs.SetParent(jb, st.exe)
+	return jb, nil
+}
+
+func (srv *SAServices) _addOpenAIJob(r *http.Request) (*SAJobOpenAI, error) {
+	st, node, err := srv._readLLMRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if !node.IsTypeOpenAI() {
+		return nil, fmt.Errorf("Node is not type 'openai'")
+	}
+
+	msgs, err := srv._applyPrompt(node, st.Messages, "")
+	if err != nil {
+		return nil, err
+	}
+	props, err := node.getOpenAIProps(msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	//tools
+	tools, err := srv.NewTools(node)
+	if err != nil {
+		return nil, err
+	}
+	if tools != nil {
+		props.Tools, err = tools.GetDefinitions()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	jb := srv.base.jobs.AddOpenAI(node.app, NewSANodePath(node), props, tools)
+	srv.base.jobs.SetParent(jb, st.exe)
+	return jb, nil
+}
+
+func (srv *SAServices) handlerLLama(w http.ResponseWriter, r *http.Request) {
+	jbw, err := srv._addLLamaJob(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	var props SAServiceLLamaCppProps
-	err = json.Unmarshal(js, &props)
+
+	//wait
+	for !jbw.done.Load() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if jbw.outErr != nil {
+		http.Error(w, jbw.outErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(jbw.output)
+}
+
+func (srv *SAServices) handlerOpenAI(w http.ResponseWriter, r *http.Request) {
+	jbw, err := srv._addOpenAIJob(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	//add Model and Messages into properties
-	props.Model = node.GetAttrString("model", "")
-	props.Messages = msgs
 
-	//run & wait
-	jbw := srv.base.jobs.AddLLama(node.app, NewSANodePath(node), &props)
+	//wait
 	for !jbw.done.Load() {
 		time.Sleep(10 * time.Millisecond)
 	}
 
+	if jbw.outErr != nil {
+		http.Error(w, jbw.outErr.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Write(jbw.output)
 }
 
-func (srv *SAServices) handlerOpenAI(w http.ResponseWriter, r *http.Request) {
-	job_id, err := _SAServices_getAuthID(r)
+// writes answer parts as JSON strings(one per line) as they arrive. Error is sent as {"error": "..."}
+func _SAServices_writeStream(w http.ResponseWriter, r *http.Request, wip_answer *SAServiceAnswer, stop *atomic.Bool, done *atomic.Bool, output *[]byte, outErr *error) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+
+	writePart := func(v interface{}) {
+		js, err := json.Marshal(v)
+		if err == nil {
+			w.Write(append(js, '\n'))
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	sent := ""
+	for {
+		finished := done.Load()
+
+		answer := wip_answer.Get()
+		if finished {
+			if *outErr != nil {
+				writePart(map[string]string{"error": (*outErr).Error()})
+				return
+			}
+			answer = string(*output) //from cache, wip_answer is empty
+		}
+
+		if len(answer) > len(sent) && strings.HasPrefix(answer, sent) {
+			writePart(answer[len(sent):])
+			sent = answer
+		}
+
+		if finished {
+			return
+		}
+
+		if r.Context().Err() != nil {
+			stop.Store(true) //client closed connection
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (srv *SAServices) handlerLLamaStream(w http.ResponseWriter, r *http.Request) {
+	jbw, err := srv._addLLamaJob(r)
 	if err != nil {
-		http.Error(w, "Auth: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	jb := srv.base.jobs.FindJobExe(job_id)
-	if jb == nil {
-		http.Error(w, "exe job not found", http.StatusInternalServerError)
+
+	_SAServices_writeStream(w, r, &jbw.wip_answer, &jbw.stop, &jbw.done, &jbw.output, &jbw.outErr)
+}
+
+func (srv *SAServices) handlerOpenAIStream(w http.ResponseWriter, r *http.Request) {
+	jbw, err := srv._addOpenAIJob(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	_SAServices_writeStream(w, r, &jbw.wip_answer, &jbw.stop, &jbw.done, &jbw.output, &jbw.outErr)
+}
+
+func (srv *SAServices) handlerTTS(w http.ResponseWriter, r *http.Request) {
+	exe, body, err := srv._readExeRequest(r)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	//extract
-	msgs, node, err := srv._prepareMessages(jb, body)
+	var st struct {
+		Node string `json:"node"`
+		Text string `json:"text"`
+	}
+	err = json.Unmarshal(body, &st)
+	if err != nil {
+		http.Error(w, "Unmarshal() failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	//find node
+	node := NewSANodePathFromString(st.Node).Find(exe.app.root)
+	if node == nil {
+		http.Error(w, "Node not found", http.StatusInternalServerError)
+		return
+	}
+	if !node.IsTypeTTS() {
+		http.Error(w, "Node is not type 'tts'", http.StatusInternalServerError)
+		return
+	}
+
+	voice, props, err := node.getTTSProps()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if !node.IsTypeOpenAI() {
-		http.Error(w, "Node is not type 'openai'", http.StatusInternalServerError)
+
+	//run & wait
+	jb := srv.base.jobs.AddTTS(node.app, NewSANodePath(node), voice, st.Text, props)
+	srv.base.jobs.SetParent(jb, exe)
+	for !jb.done.Load() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if jb.outErr != nil {
+		http.Error(w, jb.outErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(jb.output) //WAV
+}
+
+type SAServicesEmbeddingsRequest struct {
+	Node string `json:"node"`
+	Op   string `json:"op"` //"ingest", "search"
+
+	Table  string `json:"table"` //ingest
+	Column string `json:"column"`
+
+	Query string `json:"query"` //search
+	K     int    `json:"k"`
+}
+
+func (srv *SAServices) handlerEmbeddings(w http.ResponseWriter, r *http.Request) {
+	exe, body, err := srv._readExeRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	props := &SAServiceOpenAIProps{Model: node.GetAttrString("model", "gpt-3.5-turbo"), Messages: msgs}
-	//more properties ..........
+	var st SAServicesEmbeddingsRequest
+	err = json.Unmarshal(body, &st)
+	if err != nil {
+		http.Error(w, "Unmarshal() failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	//find node
+	node := NewSANodePathFromString(st.Node).Find(exe.app.root)
+	if node == nil {
+		http.Error(w, "Node not found", http.StatusInternalServerError)
+		return
+	}
+	if !node.IsTypeEmbeddings() {
+		http.Error(w, "Node is not type 'embeddings'", http.StatusInternalServerError)
+		return
+	}
+
+	props, llama, db, table, err := node.getEmbeddingsProps()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jb := NewSAJobEmbeddings(node.app, NewSANodePath(node), props, llama, db, table, srv.base.jobs)
+	jb.op = st.Op
+	jb.src_table = st.Table
+	jb.column = st.Column
+	jb.query = st.Query
+	jb.k = st.K
 
 	//run & wait
-	jbw := srv.base.jobs.AddOpenAI(node.app, NewSANodePath(node), props)
-	for !jbw.done.Load() {
+	srv.base.jobs.AddEmbeddings(jb)
+	srv.base.jobs.SetParent(jb, exe)
+	for !jb.done.Load() {
 		time.Sleep(10 * time.Millisecond)
 	}
 
-	w.Write(jbw.output)
+	if jb.outErr != nil {
+		http.Error(w, jb.outErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(jb.output)
 }
 
 func (srv *SAServices) handlerNetwork(w http.ResponseWriter, r *http.Request) {
@@ -371,6 +663,48 @@ func (srv *SAServices) handlerNetwork(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("{}"))
 }
 
+func (srv *SAServices) handlerHttp(w http.ResponseWriter, r *http.Request) {
+	exe, body, err := srv._readExeRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var st struct {
+		Node string            `json:"node"`
+		Vars map[string]string `json:"vars"`
+	}
+	err = json.Unmarshal(body, &st)
+	if err != nil {
+		http.Error(w, "Unmarshal() failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	//find node
+	node := NewSANodePathFromString(st.Node).Find(exe.app.root)
+	if node == nil {
+		http.Error(w, "Node not found", http.StatusInternalServerError)
+		return
+	}
+	if !node.IsTypeHttp() {
+		http.Error(w, "Node is not type 'http'", http.StatusInternalServerError)
+		return
+	}
+
+	//run & wait
+	jb := srv.base.jobs.AddHttp(node.app, NewSANodePath(node), node.getHttpProps(), st.Vars)
+	srv.base.jobs.SetParent(jb, exe)
+	for !jb.done.Load() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if jb.outErr != nil {
+		http.Error(w, jb.outErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(jb.output)
+}
+
 func (srv *SAServices) Run(port int) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/getjob", srv.handlerGetJob)
@@ -379,7 +713,13 @@ func (srv *SAServices) Run(port int) {
 	mux.HandleFunc("/whispercpp", srv.handlerWhisper)
 	mux.HandleFunc("/llamacpp", srv.handlerLLama)
 	mux.HandleFunc("/openai", srv.handlerOpenAI)
+	mux.HandleFunc("/llamacpp_stream", srv.handlerLLamaStream)
+	mux.HandleFunc("/openai_stream", srv.handlerOpenAIStream)
 	mux.HandleFunc("/net", srv.handlerNetwork)
+	mux.HandleFunc("/http", srv.handlerHttp)
+	mux.HandleFunc("/webhook/", srv.handlerWebhook)
+	mux.HandleFunc("/embeddings", srv.handlerEmbeddings)
+	mux.HandleFunc("/tts", srv.handlerTTS)
 	srv.server = &http.Server{Addr: ":" + strconv.Itoa(port), Handler: mux}
 
 	go func() {
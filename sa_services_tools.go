@@ -0,0 +1,374 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const SAServicesTools_maxRounds = 10
+const SAServicesTools_maxRows = 100
+const SAServicesTools_maxDepth = 3 //code -> llm -> tool code -> llm ...
+
+// Nodes exposed to LLM as tools. Model asks for tool call, SAServices executes node and sends result back.
+type SAServicesTools struct {
+	srv   *SAServices
+	app   *SAApp
+	nodes []SANodePath
+
+	parent SAJob //LLM job which calls tools, set by SAJobs.AddLLama()/AddOpenAI()
+}
+
+// list is node attribute "tool_nodes": "db, download, transcribe"
+func SAServicesTools_parseList(list string) []string {
+	var names []string
+	for _, nm := range strings.Split(list, ",") {
+		nm = strings.TrimSpace(nm)
+		if nm != "" {
+			names = append(names, nm)
+		}
+	}
+	return names
+}
+
+func SAServicesTools_isSupported(node *SANode) bool {
+	return node.IsTypeDbFile() || node.IsTypeNet() || node.IsTypeWhispercpp() || node.IsTypeCode()
+}
+
+func (srv *SAServices) NewTools(llmNode *SANode) (*SAServicesTools, error) {
+	names := SAServicesTools_parseList(llmNode.GetAttrString("tool_nodes", ""))
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	tl := &SAServicesTools{srv: srv, app: llmNode.app}
+	root := llmNode.GetRoot()
+	for _, nm := range names {
+		node := root.FindNode(nm)
+		if node == nil {
+			return nil, fmt.Errorf("tool node '%s' not found", nm)
+		}
+		if !SAServicesTools_isSupported(node) {
+			return nil, fmt.Errorf("node '%s' can't be tool(only db_file, net, whispercpp, code)", nm)
+		}
+		tl.nodes = append(tl.nodes, NewSANodePath(node))
+	}
+	return tl, nil
+}
+
+func (tl *SAServicesTools) GetDefinitions() ([]SAServiceTool, error) {
+	var tools []SAServiceTool
+	for _, path := range tl.nodes {
+		node := path.Find(tl.app.root)
+		if node == nil {
+			return nil, fmt.Errorf("tool node '%s' not found", path.String())
+		}
+
+		fn := SAServiceToolFunction{Name: node.Name}
+		switch {
+		case node.IsTypeDbFile():
+			tables, err := tl.getDbTables(node)
+			if err != nil {
+				return nil, err
+			}
+			fn.Description = fmt.Sprintf("Runs read-only SQL query(SELECT) on SQLite database and returns rows as JSON array. Tables(columns): %s", tables)
+			fn.Parameters = map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"query": map[string]interface{}{"type": "string", "description": "SQL SELECT query"}},
+				"required":   []string{"query"},
+			}
+
+		case node.IsTypeNet():
+			fn.Description = fmt.Sprintf("Downloads file from '%s' + url into local file", node.GetAttrString("url", ""))
+			fn.Parameters = map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"url":       map[string]interface{}{"type": "string", "description": "path relative to server url"},
+					"file_path": map[string]interface{}{"type": "string", "description": "destination file, relative to app folder"},
+				},
+				"required": []string{"url", "file_path"},
+			}
+
+		case node.IsTypeWhispercpp():
+			fn.Description = "Transcribes audio file(.wav) into text"
+			fn.Parameters = map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"file_path": map[string]interface{}{"type": "string", "description": "audio file, relative to app folder"}},
+				"required":   []string{"file_path"},
+			}
+
+		case node.IsTypeCode():
+			fn.Description = "Executes program and returns its output as JSON. Output is not applied to other nodes"
+			if len(node.Code.Messages) > 0 && node.Code.Messages[0].User != "" {
+				fn.Description += ". Program: " + node.Code.Messages[0].User
+			}
+			fn.Parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+
+		tools = append(tools, SAServiceTool{Type: "function", Function: fn})
+	}
+	return tools, nil
+}
+
+func (tl *SAServicesTools) getDbTables(node *SANode) (string, error) {
+	db, _, err := tl.app.base.ui.win.disk.OpenDb(node.GetAttrString("path", ""))
+	if err != nil {
+		return "", fmt.Errorf("OpenDb() failed: %w", err)
+	}
+	info, err := db.GetTableInfo()
+	if err != nil {
+		return "", fmt.Errorf("GetTableInfo() failed: %w", err)
+	}
+
+	str := ""
+	for _, tb := range info {
+		str += fmt.Sprintf("%s(%s), ", tb.Name, tb.ListOfColumnNames(false))
+	}
+	str, _ = strings.CutSuffix(str, ", ")
+	return str, nil
+}
+
+// Calls complete() until model stops asking for tools. tl can be nil.
+func (tl *SAServicesTools) Run(messages *[]SAServiceMsg, stop *atomic.Bool, complete func() ([]byte, []SAServiceToolCall, error)) ([]byte, error) {
+	for round := 0; ; round++ {
+		out, calls, err := complete()
+		if err != nil {
+			return nil, err
+		}
+		if len(calls) == 0 {
+			return out, nil
+		}
+		if tl == nil {
+			return nil, fmt.Errorf("model asked for tool, but node has no tool_nodes")
+		}
+		if round >= SAServicesTools_maxRounds {
+			return nil, fmt.Errorf("too many tool rounds(%d)", SAServicesTools_maxRounds)
+		}
+
+		*messages = append(*messages, SAServiceMsg{Role: "assistant", Content: string(out), Tool_calls: calls})
+		for _, call := range calls {
+			if stop.Load() {
+				return nil, fmt.Errorf("user Cancel the job")
+			}
+
+			result, err := tl.call(call, stop)
+			if err != nil {
+				result = "error: " + err.Error() //model can try again
+			}
+			fmt.Printf("Tool '%s'(%s) returned %d bytes\n", call.Function.Name, call.Function.Arguments, len(result))
+
+			*messages = append(*messages, SAServiceMsg{Role: "tool", Content: result, Tool_call_id: call.Id})
+		}
+	}
+}
+
+func (tl *SAServicesTools) call(call SAServiceToolCall, stop *atomic.Bool) (string, error) {
+	var node *SANode
+	for _, path := range tl.nodes {
+		nd := path.Find(tl.app.root)
+		if nd != nil && nd.Name == call.Function.Name {
+			node = nd
+			break
+		}
+	}
+	if node == nil {
+		return "", fmt.Errorf("tool '%s' not found", call.Function.Name)
+	}
+
+	var args map[string]interface{}
+	if strings.TrimSpace(call.Function.Arguments) != "" {
+		err := json.Unmarshal([]byte(call.Function.Arguments), &args)
+		if err != nil {
+			return "", fmt.Errorf("arguments Unmarshal() failed: %w", err)
+		}
+	}
+	getArg := func(name string) string {
+		str, _ := args[name].(string)
+		return str
+	}
+
+	switch {
+	case node.IsTypeDbFile():
+		return tl.callDb(node, getArg("query"))
+	case node.IsTypeNet():
+		return tl.callNet(node, getArg("url"), getArg("file_path"), stop)
+	case node.IsTypeWhispercpp():
+		return tl.callWhisper(node, getArg("file_path"))
+	case node.IsTypeCode():
+		return tl.callCode(node)
+	}
+	return "", fmt.Errorf("node '%s' can't be tool", node.Name)
+}
+
+// model output is untrusted, so file is always inside app folder
+func (tl *SAServicesTools) getAppFilePath(file_path string) (string, error) {
+	if file_path == "" {
+		return "", fmt.Errorf("file_path is empty")
+	}
+	folder, err := filepath.Abs(tl.app.GetFolderPath())
+	if err != nil {
+		return "", fmt.Errorf("Abs() failed: %w", err)
+	}
+
+	p := filepath.Join(folder, filepath.Clean(string(filepath.Separator)+file_path)) //Clean() removes '..' above root
+	if !strings.HasPrefix(p, folder+string(filepath.Separator)) {
+		return "", fmt.Errorf("file_path '%s' is outside of app folder", file_path)
+	}
+	return p, nil
+}
+
+func (tl *SAServicesTools) callDb(node *SANode, query string) (string, error) {
+	q := strings.ToUpper(strings.TrimSpace(query))
+	if !strings.HasPrefix(q, "SELECT") && !strings.HasPrefix(q, "WITH") {
+		return "", fmt.Errorf("only SELECT query is allowed")
+	}
+
+	db, _, err := tl.app.base.ui.win.disk.OpenDb(node.GetAttrString("path", ""))
+	if err != nil {
+		return "", fmt.Errorf("OpenDb() failed: %w", err)
+	}
+
+	//prefix check is not enough("WITH ... DELETE", "SELECT 1; DROP ..."), read-only connection is
+	ro, err := db.OpenReadOnly()
+	if err != nil {
+		return "", err
+	}
+	defer ro.Close()
+
+	rows, err := ro.Query(query)
+	if err != nil {
+		return "", fmt.Errorf("Query() failed: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", fmt.Errorf("Columns() failed: %w", err)
+	}
+
+	var items []map[string]interface{}
+	for rows.Next() && len(items) < SAServicesTools_maxRows {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return "", fmt.Errorf("Scan() failed: %w", err)
+		}
+
+		item := make(map[string]interface{})
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			item[col] = values[i]
+		}
+		items = append(items, item)
+	}
+
+	js, err := json.Marshal(items)
+	if err != nil {
+		return "", fmt.Errorf("Marshal() failed: %w", err)
+	}
+	return string(js), nil
+}
+
+func (tl *SAServicesTools) callNet(node *SANode, urlPath string, file_path string, stop *atomic.Bool) (string, error) {
+	dst, err := tl.getAppFilePath(file_path)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(node.GetAttrString("url", ""))
+	if err != nil {
+		return "", fmt.Errorf("Parse() failed: %w", err)
+	}
+	u.Path = path.Join(u.Path, path.Clean("/"+urlPath)) //stays under node's url
+
+	jb := tl.srv.base.jobs.AddNet(node.app, NewSANodePath(node), dst, u.String())
+	tl.srv.base.jobs.SetParent(jb, tl.parent)
+	for !jb.done.Load() {
+		if stop.Load() {
+			jb.stop.Store(true)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if jb.outErr != nil {
+		return "", jb.outErr
+	}
+	return fmt.Sprintf("downloaded into '%s'", file_path), nil
+}
+
+func (tl *SAServicesTools) callWhisper(node *SANode, file_path string) (string, error) {
+	src, err := tl.getAppFilePath(file_path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", fmt.Errorf("ReadFile() failed: %w", err)
+	}
+
+	model, props, err := node.getWhisperProps()
+	if err != nil {
+		return "", err
+	}
+
+	jb := tl.srv.base.jobs.AddWhisper(node.app, NewSANodePath(node), model, InitOsBlob(data), props)
+	tl.srv.base.jobs.SetParent(jb, tl.parent)
+	for !jb.done.Load() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if jb.outErr != nil {
+		return "", jb.outErr
+	}
+	return string(jb.output), nil
+}
+
+func (tl *SAServicesTools) callCode(node *SANode) (string, error) {
+	inputJs, err := node.Code.buildExeInput(nil)
+	if err != nil {
+		return "", fmt.Errorf("buildExeInput() failed: %w", err)
+	}
+
+	//program can call llm again, which can call this tool again
+	depth := tl.srv.base.jobs.GetDepth(tl.parent)
+	if depth >= SAServicesTools_maxDepth {
+		return "", fmt.Errorf("too many nested tool calls(%d)", depth)
+	}
+
+	//output is only returned to model, it's not applied to nodes, so it doesn't trigger other nodes
+	jb := tl.srv.base.jobs.AddExeIsolated(node.app, NewSANodePath(node), "/temp/go/", node.Code.GetFileName(), inputJs)
+	tl.srv.base.jobs.SetParent(jb, tl.parent)
+	for !jb.done.Load() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if jb.outErr != nil {
+		return "", jb.outErr
+	}
+	return string(jb.outJs), nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2023 Milan Suk
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this db except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Audio output. Whole sound is decoded into memory and queued into device(no callback).
+type WinAudio struct {
+	device sdl.AudioDeviceID
+	spec   sdl.AudioSpec
+
+	data       []byte //PCM S16
+	frameBytes int    //bytes per sample * channels
+
+	start_pos int //bytes, where queue starts
+	playing   bool
+}
+
+// WAV file content
+func NewWinAudioWav(wavData []byte) (*WinAudio, error) {
+	dec := wav.NewDecoder(bytes.NewReader(wavData))
+	if !dec.IsValidFile() {
+		return nil, errors.New("invalid WAV data")
+	}
+	buff, err := dec.FullPCMBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("FullPCMBuffer() failed: %w", err)
+	}
+	return NewWinAudio(buff)
+}
+
+func NewWinAudio(buff *audio.IntBuffer) (*WinAudio, error) {
+	au := &WinAudio{}
+
+	if buff.Format == nil || buff.Format.NumChannels <= 0 || buff.Format.SampleRate <= 0 {
+		return nil, errors.New("invalid audio format")
+	}
+
+	//convert to S16
+	shift := buff.SourceBitDepth - 16
+	au.data = make([]byte, len(buff.Data)*2)
+	for i, v := range buff.Data {
+		if buff.SourceBitDepth == 8 {
+			v = (v - 128) << 8 //8bit is unsigned
+		} else if shift > 0 {
+			v >>= shift
+		}
+		binary.LittleEndian.PutUint16(au.data[i*2:], uint16(int16(v)))
+	}
+	au.frameBytes = 2 * buff.Format.NumChannels
+
+	au.spec.Freq = int32(buff.Format.SampleRate)
+	au.spec.Format = sdl.AUDIO_S16
+	au.spec.Channels = uint8(buff.Format.NumChannels)
+	au.spec.Samples = 4096
+
+	var err error
+	au.device, err = sdl.OpenAudioDevice("", false, &au.spec, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAudioDevice() failed: %w", err)
+	}
+	sdl.PauseAudioDevice(au.device, true)
+
+	return au, nil
+}
+
+func (au *WinAudio) Destroy() {
+	sdl.CloseAudioDevice(au.device)
+}
+
+func (au *WinAudio) bytesPerSec() float64 {
+	return float64(int(au.spec.Freq) * au.frameBytes)
+}
+
+// seconds
+func (au *WinAudio) GetDuration() float64 {
+	return float64(len(au.data)) / au.bytesPerSec()
+}
+
+// seconds
+func (au *WinAudio) GetPos() float64 {
+	queued := int(sdl.GetQueuedAudioSize(au.device))
+	pos := len(au.data) - queued
+	if !au.playing && queued == 0 {
+		pos = au.start_pos //paused or not started
+	}
+	return float64(pos) / au.bytesPerSec()
+}
+
+func (au *WinAudio) Play() {
+	if au.playing {
+		return
+	}
+	if au.start_pos >= len(au.data) {
+		au.start_pos = 0 //from beginning
+	}
+
+	//queue rest
+	if sdl.GetQueuedAudioSize(au.device) == 0 {
+		err := sdl.QueueAudio(au.device, au.data[au.start_pos:])
+		if err != nil {
+			fmt.Println("QueueAudio() failed:", err)
+			return
+		}
+	}
+	sdl.PauseAudioDevice(au.device, false)
+	au.playing = true
+}
+
+func (au *WinAudio) Pause() {
+	if !au.playing {
+		return
+	}
+	sdl.PauseAudioDevice(au.device, true)
+	au.playing = false
+}
+
+// seconds
+func (au *WinAudio) Seek(pos float64) {
+	p := int(pos*au.bytesPerSec()) / au.frameBytes * au.frameBytes
+	au.start_pos = OsClamp(p, 0, len(au.data))
+
+	sdl.ClearQueuedAudio(au.device)
+	if au.playing {
+		au.playing = false
+		au.Play()
+	}
+}
+
+func (au *WinAudio) IsPlaying() bool {
+	return au.playing
+}
+
+// returns true once, when queue was played till the end
+func (au *WinAudio) CheckFinished() bool {
+	if au.playing && sdl.GetQueuedAudioSize(au.device) == 0 {
+		sdl.PauseAudioDevice(au.device, true)
+		au.playing = false
+		au.start_pos = len(au.data)
+		return true
+	}
+	return false
+}
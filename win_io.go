@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"runtime"
 	"time"
 
 	"github.com/veandco/go-sdl2/sdl"
@@ -144,9 +145,17 @@ type WinIni struct {
 	Offline bool
 	MicOff  bool
 
-	ChatModel string
+	ChatModel string //old, moved into Chat
+	Chat      SAChatBackend
 
 	OpenAI_key string
+
+	Cache_max_mb   int //results of AI services
+	Cache_ttl_days int
+
+	LLama_servers int //models loaded at same time
+
+	Services_idle_min int //local AI servers are stopped after being unused, -1 = never
 }
 
 type WinIO struct {
@@ -261,8 +270,9 @@ func (io *WinIO) _IO_setDefault() error {
 		io.ini.Theme = "light"
 	}
 
-	if io.ini.ChatModel == "" {
-		io.ini.ChatModel = "gpt-4-turbo"
+	if io.ini.Chat.Backend == "" {
+		io.ini.Chat.Backend = "openai"
+		io.ini.Chat.Model = OsTrnString(io.ini.ChatModel != "", io.ini.ChatModel, "gpt-4-turbo")
 	}
 
 	if io.ini.CustomPalette.P.A == 0 {
@@ -283,7 +293,20 @@ func (io *WinIO) _IO_setDefault() error {
 	}
 
 	if io.ini.Threads <= 0 {
-		io.ini.Threads = 1 //runtime.NumCPU()
+		io.ini.Threads = runtime.NumCPU() //parallel compilations and code executions
+	}
+
+	if io.ini.Cache_max_mb <= 0 {
+		io.ini.Cache_max_mb = 512
+	}
+	if io.ini.Cache_ttl_days <= 0 {
+		io.ini.Cache_ttl_days = 30
+	}
+	if io.ini.LLama_servers <= 0 {
+		io.ini.LLama_servers = 1
+	}
+	if io.ini.Services_idle_min == 0 {
+		io.ini.Services_idle_min = 15
 	}
 
 	return nil